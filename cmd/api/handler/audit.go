@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/gorilla/sessions"
+	"html/template"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"twilu/internal/controller"
+	"twilu/internal/model"
+)
+
+type AuditHandler struct {
+	store      *sessions.CookieStore
+	controller *controller.AuditController
+}
+
+func NewAuditHandler(store *sessions.CookieStore, controller *controller.AuditController) *AuditHandler {
+	return &AuditHandler{
+		store:      store,
+		controller: controller}
+}
+
+func (ah *AuditHandler) GetUserEvents(w http.ResponseWriter, r *http.Request) {
+	sess, err := ah.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	events, err := ah.controller.GetUserEvents(userIDInt)
+	if err != nil {
+		http.Error(w, "Unable to get audit log", http.StatusInternalServerError)
+		return
+	}
+	renderAuditEvents(w, r, events)
+}
+func (ah *AuditHandler) GetFolderEvents(w http.ResponseWriter, r *http.Request) {
+	sess, err := ah.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	events, err := ah.controller.GetFolderEvents(folderID, userIDInt)
+	if err != nil {
+		http.Error(w, "Unable to get audit log", http.StatusForbidden)
+		return
+	}
+	renderAuditEvents(w, r, events)
+}
+
+// renderAuditEvents writes events as JSON when ?format=json is given, and as
+// the audit.html partial otherwise.
+func renderAuditEvents(w http.ResponseWriter, r *http.Request, events []model.AuditEvent) {
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(events); err != nil {
+			http.Error(w, "Unable to marshal audit log", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "audit.html")
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Events []model.AuditEvent
+	}{
+		Events: events,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
+
+// clientIP returns the address of the client that made the request. The
+// X-Forwarded-For header is only trusted when the request comes from a
+// reverse proxy on the local network, since anyone else could forge it.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer := net.ParseIP(host)
+	if peer != nil && (peer.IsLoopback() || peer.IsPrivate()) {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	return host
+}
+
+// uintPtr returns a pointer to v, for the optional ids of an audit event.
+func uintPtr(v int) *uint {
+	u := uint(v)
+	return &u
+}
@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"github.com/gorilla/sessions"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"twilu/internal/controller"
+	"twilu/internal/model"
+)
+
+type CommentHandler struct {
+	store      *sessions.CookieStore
+	controller *controller.CommentController
+}
+
+func NewCommentHandler(store *sessions.CookieStore, controller *controller.CommentController) *CommentHandler {
+	return &CommentHandler{
+		store:      store,
+		controller: controller}
+}
+
+func (ch *CommentHandler) GetComments(w http.ResponseWriter, r *http.Request) {
+	sess, err := ch.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	itemID := 0
+	if item := r.URL.Query().Get("item"); item != "" {
+		if itemID, err = strconv.Atoi(item); err != nil {
+			http.Error(w, "unable to convert id", http.StatusBadGateway)
+			return
+		}
+	}
+	ch.renderComments(w, folderID, itemID, userIDInt)
+}
+func (ch *CommentHandler) AddComment(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing the form", http.StatusInternalServerError)
+		return
+	}
+	sess, err := ch.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	comment := model.Comment{FolderID: uint(folderID), Body: r.PostFormValue("body")}
+	if item := r.PostFormValue("item"); item != "" {
+		itemID, err := strconv.Atoi(item)
+		if err != nil {
+			http.Error(w, "unable to convert id", http.StatusBadGateway)
+			return
+		}
+		comment.ItemID = uintPtr(itemID)
+	}
+	if parent := r.PostFormValue("parent"); parent != "" {
+		parentID, err := strconv.Atoi(parent)
+		if err != nil {
+			http.Error(w, "unable to convert id", http.StatusBadGateway)
+			return
+		}
+		comment.ParentID = uintPtr(parentID)
+	}
+	comment, err = ch.controller.AddComment(comment, userIDInt)
+	if err != nil {
+		http.Error(w, "Unable to add comment: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ch.renderComments(w, int(comment.FolderID), commentItemID(comment), userIDInt)
+}
+func (ch *CommentHandler) EditComment(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing the form", http.StatusInternalServerError)
+		return
+	}
+	sess, err := ch.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	commentID, err := strconv.Atoi(r.PathValue("commentID"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	// The folder page asks for the new text with hx-prompt.
+	body := r.PostFormValue("body")
+	if body == "" {
+		body = r.Header.Get("HX-Prompt")
+	}
+	comment, err := ch.controller.EditComment(commentID, userIDInt, body)
+	if err != nil {
+		http.Error(w, "Unable to edit comment: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ch.renderComments(w, int(comment.FolderID), commentItemID(comment), userIDInt)
+}
+func (ch *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	sess, err := ch.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	commentID, err := strconv.Atoi(r.PathValue("commentID"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	comment, err := ch.controller.DeleteComment(commentID, userIDInt)
+	if err != nil {
+		http.Error(w, "Unable to delete comment", http.StatusForbidden)
+		return
+	}
+	ch.renderComments(w, int(comment.FolderID), commentItemID(comment), userIDInt)
+}
+
+// renderComments writes the comments.html partial for the comments on a
+// folder, or on one of its items if itemID is not zero.
+func (ch *CommentHandler) renderComments(w http.ResponseWriter, folderID int, itemID int, userID int) {
+	threads, err := ch.controller.GetComments(folderID, itemID, userID)
+	if err != nil {
+		http.Error(w, "Unable to get comments", http.StatusForbidden)
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "comments.html")
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		FolderID int
+		ItemID   int
+		Threads  []*controller.CommentThread
+	}{
+		FolderID: folderID,
+		ItemID:   itemID,
+		Threads:  threads,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
+
+// commentItemID returns the id of the item a comment is on, or zero for a
+// comment on the folder itself.
+func commentItemID(comment model.Comment) int {
+	if comment.ItemID == nil {
+		return 0
+	}
+	return int(*comment.ItemID)
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/gorilla/sessions"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"twilu/internal/controller"
+	"twilu/internal/realtime"
+)
+
+// eventsKeepAlive is how often an idle event stream sends a comment, so that
+// proxies don't close it.
+const eventsKeepAlive = 30 * time.Second
+
+type EventsHandler struct {
+	store      *sessions.CookieStore
+	controller *controller.FolderController
+	events     realtime.FanOut
+}
+
+func NewEventsHandler(store *sessions.CookieStore, controller *controller.FolderController, events realtime.FanOut) *EventsHandler {
+	return &EventsHandler{
+		store:      store,
+		controller: controller,
+		events:     events}
+}
+
+// Stream sends the folder's item changes as Server-Sent Events until the
+// client goes away. Each event is named after its kind and carries a short
+// HTML notice.
+func (eh *EventsHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	sess, err := eh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	canView, err := eh.controller.CanViewFolder(folderID, userIDInt)
+	if err != nil || !canView {
+		http.Error(w, "unable to find folder", http.StatusForbidden)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, cancel := eh.events.Subscribe(uint(folderID))
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Kind, eventNotice(event))
+		}
+		flusher.Flush()
+	}
+}
+
+// eventNotice describes an event for the people looking at the folder.
+func eventNotice(event realtime.Event) string {
+	verb := "changed"
+	switch event.Kind {
+	case controller.ActivityItemAdded:
+		verb = "added"
+	case controller.ActivityItemRemoved:
+		verb = "removed"
+	case controller.ActivityItemRenamed:
+		verb = "renamed an item to"
+	}
+	// A line break would end the event's data early.
+	name := strings.NewReplacer("\r", " ", "\n", " ").Replace(event.Name)
+	return fmt.Sprintf("<p>@%s %s <strong>%s</strong></p>",
+		template.HTMLEscapeString(event.ActorUsername), verb, template.HTMLEscapeString(name))
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+	"twilu/internal/controller"
+	"twilu/internal/feed"
+)
+
+// FeedHandler serves public folders and profiles as Atom, RSS and JSON feeds.
+// Feeds are public, so they need no session.
+type FeedHandler struct {
+	folderController *controller.FolderController
+	userController   *controller.UserController
+}
+
+func NewFeedHandler(folderController *controller.FolderController, userController *controller.UserController) *FeedHandler {
+	return &FeedHandler{
+		folderController: folderController,
+		userController:   userController}
+}
+
+type feedFormat struct {
+	contentType string
+	write       func(w io.Writer, f feed.Feed) error
+}
+
+var (
+	atomFormat = feedFormat{feed.AtomContentType, feed.WriteAtom}
+	rssFormat  = feedFormat{feed.RSSContentType, feed.WriteRSS}
+	jsonFormat = feedFormat{feed.JSONContentType, feed.WriteJSON}
+)
+
+func (fh *FeedHandler) FolderAtom(w http.ResponseWriter, r *http.Request) {
+	fh.serveFolder(w, r, atomFormat)
+}
+func (fh *FeedHandler) FolderRSS(w http.ResponseWriter, r *http.Request) {
+	fh.serveFolder(w, r, rssFormat)
+}
+func (fh *FeedHandler) FolderJSON(w http.ResponseWriter, r *http.Request) {
+	fh.serveFolder(w, r, jsonFormat)
+}
+func (fh *FeedHandler) UserAtom(w http.ResponseWriter, r *http.Request) {
+	fh.serveUser(w, r, atomFormat)
+}
+func (fh *FeedHandler) UserRSS(w http.ResponseWriter, r *http.Request) {
+	fh.serveUser(w, r, rssFormat)
+}
+func (fh *FeedHandler) UserJSON(w http.ResponseWriter, r *http.Request) {
+	fh.serveUser(w, r, jsonFormat)
+}
+
+func (fh *FeedHandler) serveFolder(w http.ResponseWriter, r *http.Request, format feedFormat) {
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	folder, err := fh.folderController.GetPublicFolder(folderID)
+	if err != nil {
+		http.Error(w, "Folder not found", http.StatusNotFound)
+		return
+	}
+
+	site := siteURL(r)
+	link := fmt.Sprintf("%s/folder/%d", site, folder.ID)
+	f := feed.Feed{
+		ID:      link,
+		Title:   fmt.Sprintf("%s by @%s", folder.Name, folder.OwnerUsername),
+		Link:    link,
+		FeedURL: site + r.URL.Path,
+		Author:  "@" + folder.OwnerUsername,
+		Updated: folder.UpdatedAt,
+	}
+	for _, item := range folder.Items {
+		f.Entries = append(f.Entries, feed.Entry{
+			ID:        fmt.Sprintf("%s/items/%d", link, item.ID),
+			Title:     item.Name,
+			URL:       item.URL,
+			Published: item.CreatedAt,
+		})
+		if item.CreatedAt.After(f.Updated) {
+			f.Updated = item.CreatedAt
+		}
+	}
+	writeFeed(w, format, f)
+}
+
+func (fh *FeedHandler) serveUser(w http.ResponseWriter, r *http.Request, format feedFormat) {
+	user, items, err := fh.userController.GetPublicItems(r.PathValue("username"))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	site := siteURL(r)
+	f := feed.Feed{
+		ID:      fmt.Sprintf("%s/u/%s", site, user.Username),
+		Title:   fmt.Sprintf("@%s on Twilu", user.Username),
+		Link:    fmt.Sprintf("%s/u/%s", site, user.Username),
+		FeedURL: site + r.URL.Path,
+		Author:  "@" + user.Username,
+		Updated: user.CreatedAt,
+	}
+	for _, item := range items {
+		f.Entries = append(f.Entries, feed.Entry{
+			ID:        fmt.Sprintf("%s/folder/%d/items/%d", site, item.FolderID, item.ID),
+			Title:     fmt.Sprintf("%s (in %s)", item.Name, item.FolderName),
+			URL:       item.URL,
+			Published: item.CreatedAt,
+		})
+		if item.CreatedAt.After(f.Updated) {
+			f.Updated = item.CreatedAt
+		}
+	}
+	writeFeed(w, format, f)
+}
+
+// feedMaxAge is how long feed readers and proxies may cache a feed.
+const feedMaxAge = 15 * time.Minute
+
+func writeFeed(w http.ResponseWriter, format feedFormat, f feed.Feed) {
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(feedMaxAge.Seconds())))
+	w.Header().Set("Last-Modified", f.Updated.UTC().Format(http.TimeFormat))
+	if err := format.write(w, f); err != nil {
+		http.Error(w, "Unable to write feed", http.StatusInternalServerError)
+		return
+	}
+}
+
+// siteURL is the scheme and host the request was made to, for the absolute
+// links feeds need. As with clientIP, X-Forwarded-Proto is only trusted from a
+// proxy on a private network.
+func siteURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	} else if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		peer := net.ParseIP(host)
+		if peer != nil && (peer.IsLoopback() || peer.IsPrivate()) && r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+	}
+	return scheme + "://" + r.Host
+}
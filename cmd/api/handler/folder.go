@@ -2,25 +2,49 @@ package handler
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/gorilla/sessions"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strconv"
+	"time"
 	"twilu/internal/controller"
 	"twilu/internal/model"
 )
 
+// folderPage is the data of folder.html, which renders both folders and smart
+// folders.
+type folderPage struct {
+	Folder      model.Folder
+	IsOwner     bool
+	Breadcrumbs []model.Folder
+	Subfolders  []model.Folder
+	MoveTargets []model.Folder
+	ParentID    uint
+	// Smart is set when the page shows a smart folder, whose items come
+	// from different folders.
+	Smart *model.SmartFolder
+	// States holds the viewer's reading state of each item, and StateFilter
+	// the state the items are filtered by.
+	States      map[uint]string
+	StateFilter string
+	ItemStates  []string
+}
+
 type FolderHandler struct {
 	store      *sessions.CookieStore
 	controller *controller.FolderController
+	audit      *controller.AuditController
 }
 
-func NewFolderHandler(store *sessions.CookieStore, controller *controller.FolderController) *FolderHandler {
+func NewFolderHandler(store *sessions.CookieStore, controller *controller.FolderController, audit *controller.AuditController) *FolderHandler {
 	return &FolderHandler{
 		store:      store,
-		controller: controller}
+		controller: controller,
+		audit:      audit}
 }
 
 func (h *FolderHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
@@ -30,20 +54,64 @@ func (h *FolderHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, ok := sess.Values["userID"]
+	userID, ok := sess.Values["userID"]
 	if !ok {
 		http.Error(w, "User ID not found in session", http.StatusBadRequest)
 		return
 	}
 
-	folders, err := h.controller.GetFeed()
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	params := r.URL.Query()
+	query := controller.FeedQuery{
+		Owner:  params.Get("owner"),
+		Tag:    params.Get("tag"),
+		Sort:   params.Get("sort"),
+		Cursor: params.Get("cursor"),
+	}
+	if from := params.Get("from"); from != "" {
+		if query.From, err = time.Parse(time.DateOnly, from); err != nil {
+			http.Error(w, "Invalid from date", http.StatusBadRequest)
+			return
+		}
+	}
+	if to := params.Get("to"); to != "" {
+		if query.To, err = time.Parse(time.DateOnly, to); err != nil {
+			http.Error(w, "Invalid to date", http.StatusBadRequest)
+			return
+		}
+		// The range includes the whole of its last day.
+		query.To = query.To.AddDate(0, 0, 1)
+	}
+	folders, cursor, err := h.controller.GetFeed(query)
 	if err != nil {
-		http.Error(w, "Unable to get folders", http.StatusInternalServerError)
+		http.Error(w, "Unable to get folders: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	tmplPath := filepath.Join("./internal/web/templates", "social.html")
-	tmpl, err := template.ParseFiles(tmplPath)
+	if params.Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		page := struct {
+			Folders    []model.Folder
+			NextCursor string
+		}{
+			Folders:    folders,
+			NextCursor: cursor,
+		}
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			http.Error(w, "Unable to marshal folders", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	tmpl, err := template.ParseFiles(
+		filepath.Join("./internal/web/templates", "social.html"),
+		filepath.Join("./internal/web/templates", "reactions.html"),
+	)
 	if err != nil {
 		http.Error(w, "Unable to load template", http.StatusInternalServerError)
 		return
@@ -55,14 +123,39 @@ func (h *FolderHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The next page is requested with the same filters by the sentinel at the
+	// bottom of this one once it scrolls into view.
+	nextURL := ""
+	if cursor != "" {
+		next := url.Values{}
+		for _, key := range []string{"owner", "tag", "from", "to", "sort"} {
+			if value := params.Get(key); value != "" {
+				next.Set(key, value)
+			}
+		}
+		next.Set("cursor", cursor)
+		nextURL = "/api/feed?" + next.Encode()
+	}
+	folderReactions, err := h.reactions(userIDInt, folders)
+	if err != nil {
+		http.Error(w, "Unable to get likes", http.StatusInternalServerError)
+		return
+	}
+
 	data := struct {
 		Folders     []model.Folder
 		FoldersJSON template.JS
 		HasFolders  bool
+		Continued   bool
+		NextURL     string
+		Reactions   map[uint]reactions
 	}{
 		Folders:     folders,
 		FoldersJSON: template.JS(foldersJSON),
 		HasFolders:  len(folders) > 0,
+		Continued:   query.Cursor != "",
+		NextURL:     nextURL,
+		Reactions:   folderReactions,
 	}
 
 	w.Header().Set("Content-Type", "text/html")
@@ -73,27 +166,53 @@ func (h *FolderHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
 	}
 }
 func (h *FolderHandler) GetFolder(w http.ResponseWriter, r *http.Request) {
-	_, err := h.store.Get(r, "twilu-cookie")
+	sess, err := h.store.Get(r, "twilu-cookie")
 	if err != nil {
 		http.Error(w, "Bad session", http.StatusBadGateway)
 		return
 	}
+	userIDInt, _ := sess.Values["userID"].(int)
 	folderID, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
 		http.Error(w, "unable to find folder", http.StatusBadRequest)
 		return
 	}
-	folder, err := h.controller.GetFolder(folderID)
+	folder, err := h.controller.GetFolder(folderID, userIDInt)
+	if err != nil {
+		http.Error(w, "unable to find folder", http.StatusNotFound)
+		return
+	}
+	breadcrumbs, err := h.controller.GetBreadcrumbs(folder, userIDInt)
 	if err != nil {
 		http.Error(w, "unable to find folder", http.StatusBadRequest)
 		return
 	}
-	type TemplateData struct {
-		Folder model.Folder // Assuming Folder is the struct type
+	subfolders, err := h.controller.GetSubfolders(folderID, userIDInt)
+	if err != nil {
+		http.Error(w, "unable to find folder", http.StatusBadRequest)
+		return
+	}
+	states, err := h.controller.GetItemStates(userIDInt, folder.Items)
+	if err != nil {
+		http.Error(w, "unable to find folder", http.StatusBadRequest)
+		return
+	}
+	stateFilter := r.URL.Query().Get("state")
+	folder.Items = controller.FilterItemsByState(folder.Items, states, stateFilter)
+	tmplData := folderPage{Folder: folder, IsOwner: folder.Owner == uint(userIDInt), Breadcrumbs: breadcrumbs, Subfolders: subfolders}
+	tmplData.States, tmplData.StateFilter, tmplData.ItemStates = states, stateFilter, controller.ItemStates
+	if folder.ParentID != nil {
+		tmplData.ParentID = *folder.ParentID
+	}
+	if tmplData.IsOwner && !folder.Inbox {
+		if tmplData.MoveTargets, err = h.controller.GetMoveTargets(folderID, userIDInt); err != nil {
+			http.Error(w, "unable to find folder", http.StatusBadRequest)
+			return
+		}
 	}
-	tmplData := TemplateData{Folder: folder}
 	tmplPath := filepath.Join("./internal/web/templates", "folder.html")
-	tmpl, err := template.ParseFiles(tmplPath)
+	notesPath := filepath.Join("./internal/web/templates", "itemNotes.html")
+	tmpl, err := template.New("folder.html").Funcs(notesFuncs).ParseFiles(tmplPath, notesPath)
 	if err != nil {
 		http.Error(w, "Unable to load template", http.StatusInternalServerError)
 		return
@@ -118,6 +237,20 @@ func (h *FolderHandler) CreateFolder(w http.ResponseWriter, r *http.Request) {
 		folder.Private = true
 	}
 	folder.CoverURL = r.PostFormValue("coverUrl")
+	tags, err := controller.ParseTags(r.PostFormValue("tags"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	folder.Tags = tags
+	if raw := r.PostFormValue("parentID"); raw != "" {
+		parentID, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "unable to convert id", http.StatusBadRequest)
+			return
+		}
+		folder.ParentID = uintPtr(parentID)
+	}
 
 	sess, err := h.store.Get(r, "twilu-cookie")
 	if err != nil {
@@ -137,11 +270,17 @@ func (h *FolderHandler) CreateFolder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	create := h.controller.CreateFolder(folder, userIDInt)
-	if create != nil {
+	folder, err = h.controller.CreateFolder(folder, userIDInt)
+	if err != nil {
 		http.Error(w, "Failed to create folder", http.StatusBadRequest)
 		return
 	}
+	h.audit.Record(model.AuditEvent{ActorID: uint(userIDInt), Action: controller.AuditFolderCreated, FolderID: &folder.ID, IP: clientIP(r), Detail: folder.Name})
+	if folder.ParentID != nil {
+		w.Header().Set("HX-Redirect", "/folder/"+fmt.Sprint(*folder.ParentID))
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
 	w.Header().Set("HX-Redirect", "/main")
 	w.WriteHeader(http.StatusAccepted)
 }
@@ -168,10 +307,351 @@ func (h *FolderHandler) DeleteFolder(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "unable to convert id", http.StatusBadGateway)
 		return
 	}
-	if err := h.controller.DeleteFolder(folderID, userIDInt); err != nil {
+	folder, err := h.controller.DeleteFolder(folderID, userIDInt)
+	if err != nil {
 		http.Error(w, "failed to delete folder", http.StatusBadGateway)
 		return
 	}
+	h.audit.Record(model.AuditEvent{ActorID: uint(userIDInt), Action: controller.AuditFolderDeleted, FolderID: &folder.ID, IP: clientIP(r), Detail: folder.Name})
 	w.Header().Set("HX-Redirect", "/main")
 	w.WriteHeader(http.StatusAccepted)
 }
+func (h *FolderHandler) CloneFolder(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	clone, err := h.controller.CloneFolder(folderID, userIDInt)
+	if err != nil {
+		http.Error(w, "failed to clone folder", http.StatusBadRequest)
+		return
+	}
+	h.audit.Record(model.AuditEvent{ActorID: uint(userIDInt), Action: controller.AuditFolderCloned, FolderID: &clone.ID, IP: clientIP(r), Detail: fmt.Sprintf("%s from @%s", clone.Name, clone.ClonedFromOwner)})
+	w.Header().Set("HX-Redirect", "/folder/"+fmt.Sprint(clone.ID))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// MoveFolder nests the folder in the folder given by the parentID form value,
+// or moves it to the top level when parentID is empty.
+func (h *FolderHandler) MoveFolder(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing the form", http.StatusInternalServerError)
+		return
+	}
+	sess, err := h.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	parentID := 0
+	if raw := r.PostFormValue("parentID"); raw != "" {
+		if parentID, err = strconv.Atoi(raw); err != nil {
+			http.Error(w, "unable to convert id", http.StatusBadRequest)
+			return
+		}
+	}
+	folder, err := h.controller.MoveFolder(folderID, userIDInt, parentID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	detail := folder.Name + " to the top level"
+	if parentID != 0 {
+		detail = fmt.Sprintf("%s into folder %d", folder.Name, parentID)
+	}
+	h.audit.Record(model.AuditEvent{ActorID: uint(userIDInt), Action: controller.AuditFolderMoved, FolderID: &folder.ID, IP: clientIP(r), Detail: detail})
+	w.Header().Set("HX-Redirect", "/folder/"+fmt.Sprint(folder.ID))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ExportFolder downloads the folder, its items and its subfolders as JSON.
+func (h *FolderHandler) ExportFolder(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userIDInt, _ := sess.Values["userID"].(int)
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	export, err := h.controller.ExportFolder(folderID, userIDInt)
+	if err != nil {
+		http.Error(w, "unable to export folder", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="twilu-folder-%d.json"`, folderID))
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(export); err != nil {
+		http.Error(w, "Unable to marshal folder", http.StatusInternalServerError)
+	}
+}
+func (h *FolderHandler) AddContributor(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing the form", http.StatusInternalServerError)
+		return
+	}
+	sess, err := h.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	contributor, err := h.controller.AddContributor(folderID, userIDInt, r.PostFormValue("username"))
+	if err != nil {
+		fmt.Fprint(w, "<div class='error'>Unable to add contributor.</div>")
+		return
+	}
+	h.audit.Record(model.AuditEvent{ActorID: uint(userIDInt), Action: controller.AuditContributorAdded, SubjectUserID: &contributor.ID, FolderID: uintPtr(folderID), IP: clientIP(r), Detail: "@" + contributor.Username})
+	w.Header().Set("HX-Redirect", "/folder/"+fmt.Sprint(folderID))
+	w.WriteHeader(http.StatusAccepted)
+}
+func (h *FolderHandler) RemoveContributor(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	contributorID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	contributor, err := h.controller.RemoveContributor(folderID, userIDInt, contributorID)
+	if err != nil {
+		http.Error(w, "unable to remove contributor", http.StatusBadGateway)
+		return
+	}
+	h.audit.Record(model.AuditEvent{ActorID: uint(userIDInt), Action: controller.AuditContributorRemoved, SubjectUserID: &contributor.ID, FolderID: uintPtr(folderID), IP: clientIP(r), Detail: "@" + contributor.Username})
+	w.Header().Set("HX-Redirect", "/folder/"+fmt.Sprint(folderID))
+	w.WriteHeader(http.StatusAccepted)
+}
+func (h *FolderHandler) UpdateFolder(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing the form", http.StatusInternalServerError)
+		return
+	}
+
+	var changes model.Folder
+	changes.Name = r.PostFormValue("folderTitle")
+	changes.Private = r.PostFormValue("isPrivate") == "private"
+	changes.CoverURL = r.PostFormValue("coverUrl")
+	tags, err := controller.ParseTags(r.PostFormValue("tags"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	changes.Tags = tags
+
+	sess, err := h.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	if _, err := h.controller.UpdateFolder(folderID, userIDInt, changes); err != nil {
+		http.Error(w, "failed to update folder", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("HX-Redirect", "/folder/"+fmt.Sprint(folderID))
+	w.WriteHeader(http.StatusAccepted)
+}
+func (h *FolderHandler) GetActivity(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	activity, err := h.controller.GetActivity(folderID, userIDInt)
+	if err != nil {
+		http.Error(w, "unable to get folder activity", http.StatusForbidden)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(activity); err != nil {
+			http.Error(w, "Unable to marshal activity", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "activity.html")
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Activity []model.FolderActivity
+	}{
+		Activity: activity,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
+func (h *FolderHandler) GetFollowingFeed(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.controller.GetFollowingFeed(userIDInt)
+	if err != nil {
+		http.Error(w, "Unable to get feed", http.StatusInternalServerError)
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "followingFeed.html")
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+
+	var folders []model.Folder
+	for _, entry := range entries {
+		if entry.Item == nil {
+			folders = append(folders, entry.Folder)
+		}
+	}
+	foldersJSON, err := json.Marshal(folders)
+	if err != nil {
+		http.Error(w, "Unable to marshal folders", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Entries     []controller.FeedEntry
+		FoldersJSON template.JS
+	}{
+		Entries:     entries,
+		FoldersJSON: template.JS(foldersJSON),
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"twilu/internal/controller"
+	"twilu/internal/model"
+)
+
+// GetInbox renders the inbox triage view.
+func (ih *ItemHandler) GetInbox(w http.ResponseWriter, r *http.Request) {
+	sess, err := ih.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+	ih.renderInbox(w, userIDInt, "", "")
+}
+
+// AddToInbox saves the url form value to the caller's inbox, for the quick-add
+// bar on the main page.
+func (ih *ItemHandler) AddToInbox(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing the form", http.StatusInternalServerError)
+		return
+	}
+	sess, err := ih.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	item, folder, err := ih.controller.SaveToInbox(userIDInt, r.PostFormValue("url"), r.PostFormValue("title"))
+	if err != nil {
+		ih.renderQuickSaved(w, model.Item{}, model.Folder{}, "Unable to save: "+err.Error())
+		return
+	}
+	ih.audit.Record(model.AuditEvent{ActorID: uint(userIDInt), Action: controller.AuditItemAdded, FolderID: &folder.ID, ItemID: &item.ID, IP: clientIP(r), Detail: item.Name})
+	ih.renderQuickSaved(w, item, folder, "")
+}
+
+// MoveItem moves an item to the folder in the folderID form value. Moves made
+// from the inbox triage view re-render it, others go to the target folder.
+func (ih *ItemHandler) MoveItem(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing the form", http.StatusInternalServerError)
+		return
+	}
+	sess, err := ih.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	itemID, err := strconv.Atoi(r.PathValue("itemID"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	targetID, err := strconv.Atoi(r.PostFormValue("folderID"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadRequest)
+		return
+	}
+	fromInbox := r.URL.Query().Get("view") == "inbox"
+
+	item, err := ih.controller.MoveItem(folderID, itemID, targetID, userIDInt)
+	if err != nil {
+		if fromInbox {
+			ih.renderInbox(w, userIDInt, "", "Unable to move item: "+err.Error())
+			return
+		}
+		http.Error(w, "unable to move item", http.StatusBadGateway)
+		return
+	}
+	ih.audit.Record(model.AuditEvent{ActorID: uint(userIDInt), Action: controller.AuditItemMoved, FolderID: uintPtr(targetID), ItemID: &item.ID, IP: clientIP(r), Detail: item.Name})
+	if fromInbox {
+		ih.renderInbox(w, userIDInt, "Moved "+item.Name, "")
+		return
+	}
+	url := "/folder/" + fmt.Sprint(targetID)
+	w.Header().Set("HX-Redirect", url)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (ih *ItemHandler) renderInbox(w http.ResponseWriter, userID int, message string, errMsg string) {
+	inbox, err := ih.controller.GetInbox(userID)
+	if err != nil {
+		http.Error(w, "Unable to get inbox", http.StatusInternalServerError)
+		return
+	}
+	folders, _, err := ih.controller.GetQuickSaveFolders(userID)
+	if err != nil {
+		http.Error(w, "Unable to get folders", http.StatusInternalServerError)
+		return
+	}
+	targets := []model.Folder{}
+	for _, folder := range folders {
+		if folder.ID != inbox.ID {
+			targets = append(targets, folder)
+		}
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "inbox.html")
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Inbox   model.Folder
+		Folders []model.Folder
+		Message string
+		Error   string
+	}{
+		Inbox:   inbox,
+		Folders: targets,
+		Message: message,
+		Error:   errMsg,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/gorilla/sessions"
 	"net/http"
@@ -12,12 +13,14 @@ import (
 type ItemHandler struct {
 	store      *sessions.CookieStore
 	controller *controller.ItemController
+	audit      *controller.AuditController
 }
 
-func NewItemHandler(store *sessions.CookieStore, controller *controller.ItemController) *ItemHandler {
+func NewItemHandler(store *sessions.CookieStore, controller *controller.ItemController, audit *controller.AuditController) *ItemHandler {
 	return &ItemHandler{
 		store:      store,
-		controller: controller}
+		controller: controller,
+		audit:      audit}
 }
 
 func (ih *ItemHandler) AddItem(w http.ResponseWriter, r *http.Request) {
@@ -29,6 +32,7 @@ func (ih *ItemHandler) AddItem(w http.ResponseWriter, r *http.Request) {
 	var item model.Item
 	item.Name = r.PostFormValue("itemName")
 	item.URL = r.PostFormValue("itemUrl")
+	item.Notes = r.PostFormValue("itemNotes")
 
 	sess, err := ih.store.Get(r, "twilu-cookie")
 	if err != nil {
@@ -52,10 +56,12 @@ func (ih *ItemHandler) AddItem(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "unable to convert id", http.StatusBadGateway)
 		return
 	}
-	if err := ih.controller.AddItemToFolder(folderID, item, userIDInt); err != nil {
+	item, err = ih.controller.AddItemToFolder(folderID, item, userIDInt)
+	if err != nil {
 		http.Error(w, "unable to convert id", http.StatusBadGateway)
 		return
 	}
+	ih.audit.Record(model.AuditEvent{ActorID: uint(userIDInt), Action: controller.AuditItemAdded, FolderID: uintPtr(folderID), ItemID: &item.ID, IP: clientIP(r), Detail: item.Name})
 	url := "/folder/" + fmt.Sprint(folderID)
 	w.Header().Set("HX-Redirect", url)
 	w.WriteHeader(http.StatusAccepted)
@@ -88,11 +94,146 @@ func (ih *ItemHandler) DeleteItem(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "unable to convert id", http.StatusBadGateway)
 		return
 	}
-	if err := ih.controller.DeleteItem(folderID, userIDInt, itemID); err != nil {
+	item, err := ih.controller.DeleteItem(folderID, userIDInt, itemID)
+	if err != nil {
 		http.Error(w, "unable to delete item", http.StatusBadGateway)
 		return
 	}
+	ih.audit.Record(model.AuditEvent{ActorID: uint(userIDInt), Action: controller.AuditItemDeleted, FolderID: uintPtr(folderID), ItemID: &item.ID, IP: clientIP(r), Detail: item.Name})
+	url := "/folder/" + fmt.Sprint(folderID)
+	w.Header().Set("HX-Redirect", url)
+	w.WriteHeader(http.StatusAccepted)
+}
+func (ih *ItemHandler) RenameItem(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing the form", http.StatusInternalServerError)
+		return
+	}
+	sess, err := ih.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	itemID, err := strconv.Atoi(r.PathValue("itemID"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	// The folder page asks for the new name with hx-prompt.
+	name := r.PostFormValue("itemName")
+	if name == "" {
+		name = r.Header.Get("HX-Prompt")
+	}
+	if _, err := ih.controller.RenameItem(folderID, userIDInt, itemID, name); err != nil {
+		http.Error(w, "unable to rename item", http.StatusBadGateway)
+		return
+	}
 	url := "/folder/" + fmt.Sprint(folderID)
 	w.Header().Set("HX-Redirect", url)
 	w.WriteHeader(http.StatusAccepted)
 }
+
+// SetItemState records the user's reading state of an item from the state form
+// value.
+func (ih *ItemHandler) SetItemState(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing the form", http.StatusInternalServerError)
+		return
+	}
+	sess, err := ih.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	itemID, err := strconv.Atoi(r.PathValue("itemID"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	itemState, err := ih.controller.SetItemState(folderID, itemID, userIDInt, r.PostFormValue("state"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(itemState); err != nil {
+			http.Error(w, "Unable to marshal item state", http.StatusInternalServerError)
+		}
+		return
+	}
+	// The select on the folder page already shows the new state.
+	w.WriteHeader(http.StatusNoContent)
+}
+func (ih *ItemHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	sess, err := ih.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	marked, err := ih.controller.MarkAllRead(folderID, userIDInt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(struct{ Marked int }{marked}); err != nil {
+			http.Error(w, "Unable to marshal result", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("HX-Redirect", "/folder/"+fmt.Sprint(folderID))
+	w.WriteHeader(http.StatusAccepted)
+}
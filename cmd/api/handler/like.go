@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"twilu/internal/model"
+)
+
+// reactions is the data of the reactions.html partial for one folder.
+type reactions struct {
+	FolderID uint
+	Likes    int
+	Saves    int
+	Liked    bool
+	Saved    bool
+	CanSave  bool
+}
+
+func (h *FolderHandler) GetReactions(w http.ResponseWriter, r *http.Request) {
+	h.react(w, r, nil)
+}
+func (h *FolderHandler) Like(w http.ResponseWriter, r *http.Request) {
+	h.react(w, r, h.controller.LikeFolder)
+}
+func (h *FolderHandler) Unlike(w http.ResponseWriter, r *http.Request) {
+	h.react(w, r, h.controller.UnlikeFolder)
+}
+func (h *FolderHandler) Save(w http.ResponseWriter, r *http.Request) {
+	h.react(w, r, h.controller.SaveFolder)
+}
+func (h *FolderHandler) Unsave(w http.ResponseWriter, r *http.Request) {
+	h.react(w, r, h.controller.UnsaveFolder)
+}
+
+// react applies fn, if any, to the folder in the path and renders its like
+// and save buttons in their new state.
+func (h *FolderHandler) react(w http.ResponseWriter, r *http.Request, fn func(folderID int, userID int) (model.Folder, error)) {
+	sess, err := h.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	if fn != nil {
+		if _, err := fn(folderID, userIDInt); err != nil {
+			http.Error(w, "Unable to update folder: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	folder, err := h.controller.GetFolder(folderID, userIDInt)
+	if err != nil || folder.ID == 0 {
+		http.Error(w, "unable to find folder", http.StatusNotFound)
+		return
+	}
+	all, err := h.reactions(userIDInt, []model.Folder{folder})
+	if err != nil {
+		http.Error(w, "Unable to get likes", http.StatusInternalServerError)
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "reactions.html")
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.ExecuteTemplate(w, "reactions", all[folder.ID]); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
+
+// reactions returns the like and save state of each folder for the user.
+func (h *FolderHandler) reactions(userID int, folders []model.Folder) (map[uint]reactions, error) {
+	ids := make([]uint, 0, len(folders))
+	for _, folder := range folders {
+		ids = append(ids, folder.ID)
+	}
+	liked, saved, err := h.controller.GetReactions(userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	all := make(map[uint]reactions, len(folders))
+	for _, folder := range folders {
+		all[folder.ID] = reactions{
+			FolderID: folder.ID,
+			Likes:    folder.LikeCount,
+			Saves:    folder.SaveCount,
+			Liked:    liked[folder.ID],
+			Saved:    saved[folder.ID],
+			CanSave:  folder.Owner != uint(userID),
+		}
+	}
+	return all, nil
+}
+func (h *FolderHandler) GetSavedFolders(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folders, err := h.controller.GetSavedFolders(userIDInt)
+	if err != nil {
+		http.Error(w, "Unable to get saved folders", http.StatusInternalServerError)
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "savedFolders.html")
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Folders []model.Folder
+	}{
+		Folders: folders,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
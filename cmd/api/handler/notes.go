@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"twilu/internal/controller"
+	"twilu/internal/markdown"
+)
+
+// notesFuncs lets templates render item notes.
+var notesFuncs = template.FuncMap{
+	"markdown": markdown.Render,
+}
+
+func (ih *ItemHandler) UpdateNotes(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing the form", http.StatusInternalServerError)
+		return
+	}
+	sess, err := ih.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	itemID, err := strconv.Atoi(r.PathValue("itemID"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	item, err := ih.controller.UpdateNotes(folderID, userIDInt, itemID, r.PostFormValue("notes"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(item); err != nil {
+			http.Error(w, "Unable to marshal item", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "itemNotes.html")
+	tmpl, err := template.New("itemNotes.html").Funcs(notesFuncs).ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, item); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
+
+// SearchItems looks for the q query parameter in the names, URLs and notes of
+// the items in the user's folders.
+func (ih *ItemHandler) SearchItems(w http.ResponseWriter, r *http.Request) {
+	sess, err := ih.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	results, err := ih.controller.SearchItems(userIDInt, query)
+	if err != nil {
+		http.Error(w, "Unable to search items", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(results); err != nil {
+			http.Error(w, "Unable to marshal items", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "search.html")
+	tmpl, err := template.New("search.html").Funcs(notesFuncs).ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Query   string
+		Results []controller.SearchResult
+	}{
+		Query:   query,
+		Results: results,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/sessions"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"twilu/internal/controller"
+	"twilu/internal/model"
+)
+
+type NotificationHandler struct {
+	store      *sessions.CookieStore
+	controller *controller.NotificationController
+}
+
+func NewNotificationHandler(store *sessions.CookieStore, controller *controller.NotificationController) *NotificationHandler {
+	return &NotificationHandler{
+		store:      store,
+		controller: controller}
+}
+
+func (nh *NotificationHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	sess, err := nh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+	nh.renderNotifications(w, r, userIDInt)
+}
+
+// GetUnreadCount writes the number of unread notifications for the badge in
+// the page headers, or nothing when there are none.
+func (nh *NotificationHandler) GetUnreadCount(w http.ResponseWriter, r *http.Request) {
+	sess, err := nh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	count, err := nh.controller.UnreadCount(userIDInt)
+	if err != nil {
+		http.Error(w, "Unable to count notifications", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if count > 0 {
+		fmt.Fprint(w, count)
+	}
+}
+func (nh *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	sess, err := nh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	notificationID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	if err := nh.controller.MarkRead(notificationID, userIDInt); err != nil {
+		http.Error(w, "Unable to mark notification as read", http.StatusInternalServerError)
+		return
+	}
+	nh.renderNotifications(w, r, userIDInt)
+}
+func (nh *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	sess, err := nh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	if err := nh.controller.MarkAllRead(userIDInt); err != nil {
+		http.Error(w, "Unable to mark notifications as read", http.StatusInternalServerError)
+		return
+	}
+	nh.renderNotifications(w, r, userIDInt)
+}
+
+// renderNotifications writes the user's notifications as JSON when
+// ?format=json is given, and as the notifications.html partial otherwise.
+func (nh *NotificationHandler) renderNotifications(w http.ResponseWriter, r *http.Request, userID int) {
+	notifications, err := nh.controller.GetNotifications(userID)
+	if err != nil {
+		http.Error(w, "Unable to get notifications", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(notifications); err != nil {
+			http.Error(w, "Unable to marshal notifications", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "notifications.html")
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	// Let the badge in the header catch up with what was just read.
+	w.Header().Set("HX-Trigger", "notificationsRead")
+	data := struct {
+		Notifications []model.Notification
+	}{
+		Notifications: notifications,
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
+func (nh *NotificationHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	sess, err := nh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+	nh.renderPreferences(w, userIDInt, false)
+}
+func (nh *NotificationHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing the form", http.StatusInternalServerError)
+		return
+	}
+	sess, err := nh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	enabled := make(map[string]bool, len(controller.NotificationKinds))
+	for _, kind := range controller.NotificationKinds {
+		enabled[kind] = r.PostFormValue(kind) == "on"
+	}
+	if err := nh.controller.SetPreferences(userIDInt, enabled); err != nil {
+		http.Error(w, "Unable to save preferences", http.StatusInternalServerError)
+		return
+	}
+	nh.renderPreferences(w, userIDInt, true)
+}
+
+// renderPreferences writes the notificationPrefs.html partial for the user.
+func (nh *NotificationHandler) renderPreferences(w http.ResponseWriter, userID int, saved bool) {
+	enabled, err := nh.controller.GetPreferences(userID)
+	if err != nil {
+		http.Error(w, "Unable to get preferences", http.StatusInternalServerError)
+		return
+	}
+
+	type preference struct {
+		Kind    string
+		Enabled bool
+	}
+	preferences := make([]preference, 0, len(controller.NotificationKinds))
+	for _, kind := range controller.NotificationKinds {
+		preferences = append(preferences, preference{Kind: kind, Enabled: enabled[kind]})
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "notificationPrefs.html")
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Preferences []preference
+		Saved       bool
+	}{
+		Preferences: preferences,
+		Saved:       saved,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/gorilla/sessions"
+	"log"
+	"net/http"
+	"twilu/internal/controller"
+	"twilu/internal/model"
+	"twilu/internal/oidc"
+)
+
+// oidcCookie holds the state, nonce and PKCE verifier between the redirect to
+// the identity provider and its callback. It is Lax rather than Strict like
+// the login cookie, since the callback is a cross-site navigation.
+const oidcCookie = "twilu-oidc"
+
+type OIDCHandler struct {
+	store      *sessions.CookieStore
+	controller *controller.UserController
+	audit      *controller.AuditController
+	provider   *oidc.Provider
+}
+
+func NewOIDCHandler(store *sessions.CookieStore, controller *controller.UserController, audit *controller.AuditController, provider *oidc.Provider) *OIDCHandler {
+	return &OIDCHandler{
+		store:      store,
+		controller: controller,
+		audit:      audit,
+		provider:   provider}
+}
+
+func (oh *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	flow, _ := oh.store.Get(r, oidcCookie)
+	state, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, "Unable to start sign in", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, "Unable to start sign in", http.StatusInternalServerError)
+		return
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, "Unable to start sign in", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := oh.provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Single sign-on is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	flow.Options = &sessions.Options{
+		Path:     "/auth/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	flow.Values["state"] = state
+	flow.Values["nonce"] = nonce
+	flow.Values["verifier"] = verifier
+	if err := flow.Save(r, w); err != nil {
+		http.Error(w, "Failed to save session", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+func (oh *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	flow, err := oh.store.Get(r, oidcCookie)
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadRequest)
+		return
+	}
+	state, _ := flow.Values["state"].(string)
+	nonce, _ := flow.Values["nonce"].(string)
+	verifier, _ := flow.Values["verifier"].(string)
+	if state == "" || r.URL.Query().Get("state") != state {
+		http.Error(w, "Sign in expired, please try again", http.StatusBadRequest)
+		return
+	}
+	if errMsg := r.URL.Query().Get("error"); errMsg != "" {
+		http.Error(w, "Sign in was rejected: "+errMsg, http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := oh.provider.Exchange(r.Context(), r.URL.Query().Get("code"), verifier, nonce)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Unable to verify sign in", http.StatusUnauthorized)
+		return
+	}
+	user, err := oh.controller.SignInExternal(controller.ExternalIdentity{
+		Issuer:        oh.provider.Issuer(),
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Username:      claims.PreferredUsername,
+		Picture:       claims.Picture,
+	})
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Unable to sign in: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	flow.Options.MaxAge = -1
+	flow.Options.Path = "/auth/oidc"
+	if err := flow.Save(r, w); err != nil {
+		http.Error(w, "Failed to save session", http.StatusInternalServerError)
+		return
+	}
+	sess, _ := oh.store.Get(r, "twilu-cookie")
+	sess.Values["userID"] = int(user.ID)
+	sess.Values["authenticated"] = true
+	if err := sess.Save(r, w); err != nil {
+		http.Error(w, "Failed to save session", http.StatusInternalServerError)
+		return
+	}
+	oh.audit.Record(model.AuditEvent{ActorID: user.ID, ActorUsername: user.Username, Action: controller.AuditLogin, IP: clientIP(r), Detail: "single sign-on"})
+	// The login cookie is SameSite=Strict and would not be sent on a redirect
+	// chain started by the identity provider, so navigate from our own page.
+	fmt.Fprintf(w, `<script>window.location.href = "/main";</script>`)
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"twilu/internal/controller"
+	"twilu/internal/model"
+)
+
+// GetQuickSaveFolders lists the folders the caller can quick save to, as
+// <option>s for the quick save popup or as JSON for extensions.
+func (ih *ItemHandler) GetQuickSaveFolders(w http.ResponseWriter, r *http.Request) {
+	sess, err := ih.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folders, defaultFolderID, err := ih.controller.GetQuickSaveFolders(userIDInt)
+	if err != nil {
+		http.Error(w, "Unable to get folders", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		data := struct {
+			Folders         []model.Folder
+			DefaultFolderID *uint
+		}{
+			Folders:         folders,
+			DefaultFolderID: defaultFolderID,
+		}
+		if err := json.NewEncoder(w).Encode(data); err != nil {
+			http.Error(w, "Unable to marshal folders", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "quickSaveFolders.html")
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	var selected uint
+	if defaultFolderID != nil {
+		selected = *defaultFolderID
+	}
+	data := struct {
+		Folders  []model.Folder
+		Selected uint
+	}{
+		Folders:  folders,
+		Selected: selected,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
+
+// QuickSave saves a page to the picked folder, or to the caller's default
+// folder when none is picked. It takes url, title, folderID and remember as
+// form values.
+func (ih *ItemHandler) QuickSave(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing the form", http.StatusInternalServerError)
+		return
+	}
+	sess, err := ih.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID := 0
+	if raw := r.PostFormValue("folderID"); raw != "" {
+		if folderID, err = strconv.Atoi(raw); err != nil {
+			http.Error(w, "unable to convert id", http.StatusBadRequest)
+			return
+		}
+	}
+	remember := r.PostFormValue("remember") == "on" || r.PostFormValue("remember") == "true"
+	asJSON := r.URL.Query().Get("format") == "json"
+
+	item, folder, err := ih.controller.QuickSave(userIDInt, folderID, r.PostFormValue("url"), r.PostFormValue("title"), remember)
+	if err != nil {
+		if asJSON {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ih.renderQuickSaved(w, model.Item{}, model.Folder{}, "Unable to save: "+err.Error())
+		return
+	}
+	ih.audit.Record(model.AuditEvent{ActorID: uint(userIDInt), Action: controller.AuditItemAdded, FolderID: &folder.ID, ItemID: &item.ID, IP: clientIP(r), Detail: item.Name})
+
+	if asJSON {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		data := struct {
+			Item   model.Item
+			Folder model.Folder
+		}{
+			Item:   item,
+			Folder: folder,
+		}
+		if err := json.NewEncoder(w).Encode(data); err != nil {
+			http.Error(w, "Unable to marshal item", http.StatusInternalServerError)
+		}
+		return
+	}
+	ih.renderQuickSaved(w, item, folder, "")
+}
+
+func (ih *ItemHandler) renderQuickSaved(w http.ResponseWriter, item model.Item, folder model.Folder, errMsg string) {
+	tmplPath := filepath.Join("./internal/web/templates", "quickSaved.html")
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Item   model.Item
+		Folder model.Folder
+		Error  string
+	}{
+		Item:   item,
+		Folder: folder,
+		Error:  errMsg,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if errMsg == "" {
+		w.Header().Set("HX-Trigger", "quickSaved")
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
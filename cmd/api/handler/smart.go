@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/gorilla/sessions"
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"twilu/internal/controller"
+	"twilu/internal/model"
+)
+
+type SmartFolderHandler struct {
+	store      *sessions.CookieStore
+	controller *controller.SmartFolderController
+}
+
+func NewSmartFolderHandler(store *sessions.CookieStore, controller *controller.SmartFolderController) *SmartFolderHandler {
+	return &SmartFolderHandler{
+		store:      store,
+		controller: controller}
+}
+
+// smartFolderForm reads the rules of a smart folder from the name, tag,
+// domain, days and broken form values.
+func smartFolderForm(r *http.Request) (model.SmartFolder, error) {
+	smart := model.SmartFolder{
+		Name:       r.PostFormValue("name"),
+		Tag:        r.PostFormValue("tag"),
+		Domain:     r.PostFormValue("domain"),
+		BrokenOnly: r.PostFormValue("broken") == "on" || r.PostFormValue("broken") == "true",
+	}
+	if days := strings.TrimSpace(r.PostFormValue("days")); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return model.SmartFolder{}, fmt.Errorf("days must be a number")
+		}
+		smart.AddedWithinDays = n
+	}
+	return smart, nil
+}
+func (sh *SmartFolderHandler) GetSmartFolders(w http.ResponseWriter, r *http.Request) {
+	sess, err := sh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	smartFolders, err := sh.controller.GetSmartFolders(userIDInt)
+	if err != nil {
+		http.Error(w, "Unable to get smart folders", http.StatusInternalServerError)
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "smartFolders.html")
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, smartFolders); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
+func (sh *SmartFolderHandler) CreateSmartFolder(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing the form", http.StatusInternalServerError)
+		return
+	}
+	sess, err := sh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	smart, err := smartFolderForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	smart, err = sh.controller.CreateSmartFolder(smart, userIDInt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("HX-Redirect", "/smart/"+fmt.Sprint(smart.ID))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// GetSmartFolder renders the smart folder with folder.html, working out its
+// items afresh.
+func (sh *SmartFolderHandler) GetSmartFolder(w http.ResponseWriter, r *http.Request) {
+	sess, err := sh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	smartID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	smart, items, err := sh.controller.GetSmartFolder(smartID, userIDInt)
+	if err != nil {
+		http.Error(w, "unable to find smart folder", http.StatusBadRequest)
+		return
+	}
+	states, err := sh.controller.GetItemStates(userIDInt, items)
+	if err != nil {
+		http.Error(w, "unable to find smart folder", http.StatusBadRequest)
+		return
+	}
+	stateFilter := r.URL.Query().Get("state")
+	tmplData := folderPage{
+		Folder:      model.Folder{Name: smart.Name, Private: true, Items: controller.FilterItemsByState(items, states, stateFilter)},
+		Smart:       &smart,
+		States:      states,
+		StateFilter: stateFilter,
+		ItemStates:  controller.ItemStates,
+	}
+	tmplPath := filepath.Join("./internal/web/templates", "folder.html")
+	notesPath := filepath.Join("./internal/web/templates", "itemNotes.html")
+	tmpl, err := template.New("folder.html").Funcs(notesFuncs).ParseFiles(tmplPath, notesPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, tmplData); err != nil {
+		log.Println("Unable to execute template")
+		return
+	}
+}
+func (sh *SmartFolderHandler) UpdateSmartFolder(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing the form", http.StatusInternalServerError)
+		return
+	}
+	sess, err := sh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	smartID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	changes, err := smartFolderForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	smart, err := sh.controller.UpdateSmartFolder(smartID, userIDInt, changes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("HX-Redirect", "/smart/"+fmt.Sprint(smart.ID))
+	w.WriteHeader(http.StatusAccepted)
+}
+func (sh *SmartFolderHandler) DeleteSmartFolder(w http.ResponseWriter, r *http.Request) {
+	sess, err := sh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	smartID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	if _, err := sh.controller.DeleteSmartFolder(smartID, userIDInt); err != nil {
+		http.Error(w, "failed to delete smart folder", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("HX-Redirect", "/main")
+	w.WriteHeader(http.StatusAccepted)
+}
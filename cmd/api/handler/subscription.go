@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"github.com/gorilla/sessions"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"twilu/internal/controller"
+	"twilu/internal/model"
+)
+
+type SubscriptionHandler struct {
+	store      *sessions.CookieStore
+	controller *controller.SubscriptionController
+}
+
+func NewSubscriptionHandler(store *sessions.CookieStore, controller *controller.SubscriptionController) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		store:      store,
+		controller: controller}
+}
+
+func (sh *SubscriptionHandler) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	sess, err := sh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	sh.renderSubscriptions(w, folderID, userIDInt, "")
+}
+func (sh *SubscriptionHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing the form", http.StatusInternalServerError)
+		return
+	}
+	sess, err := sh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	if _, err := sh.controller.Subscribe(folderID, userIDInt, r.PostFormValue("url")); err != nil {
+		sh.renderSubscriptions(w, folderID, userIDInt, "Unable to subscribe: "+err.Error())
+		return
+	}
+	sh.renderSubscriptions(w, folderID, userIDInt, "")
+}
+func (sh *SubscriptionHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	sess, err := sh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	subscriptionID, err := strconv.Atoi(r.PathValue("subscriptionID"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	subscription, err := sh.controller.Unsubscribe(subscriptionID, userIDInt)
+	if err != nil {
+		http.Error(w, "unable to unsubscribe", http.StatusBadGateway)
+		return
+	}
+	sh.renderSubscriptions(w, int(subscription.FolderID), userIDInt, "")
+}
+
+func (sh *SubscriptionHandler) renderSubscriptions(w http.ResponseWriter, folderID int, userID int, errMsg string) {
+	subscriptions, err := sh.controller.GetSubscriptions(folderID, userID)
+	if err != nil {
+		http.Error(w, "Unable to get subscriptions", http.StatusForbidden)
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "feedSubscriptions.html")
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		FolderID      int
+		Subscriptions []model.FeedSubscription
+		Error         string
+	}{
+		FolderID:      folderID,
+		Subscriptions: subscriptions,
+		Error:         errMsg,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
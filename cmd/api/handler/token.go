@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"github.com/gorilla/sessions"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"twilu/internal/controller"
+	"twilu/internal/model"
+)
+
+type TokenHandler struct {
+	store      *sessions.CookieStore
+	controller *controller.TokenController
+}
+
+func NewTokenHandler(store *sessions.CookieStore, controller *controller.TokenController) *TokenHandler {
+	return &TokenHandler{
+		store:      store,
+		controller: controller}
+}
+
+func (th *TokenHandler) GetTokens(w http.ResponseWriter, r *http.Request) {
+	sess, err := th.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+	th.renderTokens(w, userIDInt, "", "")
+}
+func (th *TokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing the form", http.StatusInternalServerError)
+		return
+	}
+	sess, err := th.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	days, err := strconv.Atoi(r.PostFormValue("expiresIn"))
+	if err != nil {
+		th.renderTokens(w, userIDInt, "", "Please choose an expiry")
+		return
+	}
+	lifetime := time.Duration(days) * 24 * time.Hour
+	raw, err := th.controller.CreateToken(userIDInt, r.PostFormValue("tokenName"), r.PostForm["scopes"], lifetime)
+	if err != nil {
+		th.renderTokens(w, userIDInt, "", "Unable to create token: "+err.Error())
+		return
+	}
+	th.renderTokens(w, userIDInt, raw, "")
+}
+func (th *TokenHandler) DeleteToken(w http.ResponseWriter, r *http.Request) {
+	sess, err := th.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	tokenID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	if err := th.controller.DeleteToken(tokenID, userIDInt); err != nil {
+		http.Error(w, "unable to delete token", http.StatusBadGateway)
+		return
+	}
+	th.renderTokens(w, userIDInt, "", "")
+}
+
+// renderTokens writes the token list partial. newToken is only ever shown
+// once, in the response to the request that created it.
+func (th *TokenHandler) renderTokens(w http.ResponseWriter, userID int, newToken string, errMsg string) {
+	tokens, err := th.controller.GetTokens(userID)
+	if err != nil {
+		http.Error(w, "Unable to get tokens", http.StatusInternalServerError)
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "tokens.html")
+	tmpl, err := template.New("tokens.html").Funcs(template.FuncMap{
+		"scopes": func(t model.APIToken) []string { return strings.Split(t.Scopes, ",") },
+	}).ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Tokens   []model.APIToken
+		Scopes   []string
+		NewToken string
+		Error    string
+		Now      time.Time
+	}{
+		Tokens:   tokens,
+		Scopes:   controller.TokenScopes,
+		NewToken: newToken,
+		Error:    errMsg,
+		Now:      time.Now(),
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
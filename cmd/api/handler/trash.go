@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/gorilla/sessions"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+	"twilu/internal/controller"
+	"twilu/internal/model"
+)
+
+type TrashHandler struct {
+	store      *sessions.CookieStore
+	controller *controller.TrashController
+}
+
+func NewTrashHandler(store *sessions.CookieStore, controller *controller.TrashController) *TrashHandler {
+	return &TrashHandler{
+		store:      store,
+		controller: controller}
+}
+
+func (th *TrashHandler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	sess, err := th.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folders, items, err := th.controller.GetTrash(userIDInt)
+	if err != nil {
+		http.Error(w, "Unable to get trash", http.StatusInternalServerError)
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "trash.html")
+	tmpl, err := template.New("trash.html").Funcs(template.FuncMap{
+		"purgeDate": func(deletedAt time.Time) string {
+			return deletedAt.Add(th.controller.Retention).Format("Jan 2, 2006")
+		},
+	}).ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Folders  []model.Folder
+		Items    []model.Item
+		HasTrash bool
+	}{
+		Folders:  folders,
+		Items:    items,
+		HasTrash: len(folders) > 0 || len(items) > 0,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	err = tmpl.Execute(w, data)
+	if err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
+func (th *TrashHandler) RestoreFolder(w http.ResponseWriter, r *http.Request) {
+	th.act(w, r, th.controller.RestoreFolder)
+}
+func (th *TrashHandler) RestoreItem(w http.ResponseWriter, r *http.Request) {
+	th.act(w, r, th.controller.RestoreItem)
+}
+func (th *TrashHandler) PurgeFolder(w http.ResponseWriter, r *http.Request) {
+	th.act(w, r, th.controller.PurgeFolder)
+}
+func (th *TrashHandler) PurgeItem(w http.ResponseWriter, r *http.Request) {
+	th.act(w, r, th.controller.PurgeItem)
+}
+
+// act runs a restore or permanent delete on the trashed entry named by the
+// id path value, then reloads the trash page.
+func (th *TrashHandler) act(w http.ResponseWriter, r *http.Request, fn func(id int, userID int) error) {
+	sess, err := th.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	if err := fn(id, userIDInt); err != nil {
+		fmt.Fprintf(w, "<div class='error'>%s</div>", template.HTMLEscapeString(err.Error()))
+		return
+	}
+	w.Header().Set("HX-Redirect", "/trash")
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -2,12 +2,15 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/sessions"
 	"html/template"
 	"io"
 	"net/http"
 	"path/filepath"
+	"strings"
+	"time"
 	"twilu/internal/controller"
 	"twilu/internal/model"
 	"twilu/internal/util"
@@ -16,12 +19,14 @@ import (
 type UserHandler struct {
 	store      *sessions.CookieStore
 	controller *controller.UserController
+	audit      *controller.AuditController
 }
 
-func NewUserHandler(store *sessions.CookieStore, controller *controller.UserController) *UserHandler {
+func NewUserHandler(store *sessions.CookieStore, controller *controller.UserController, audit *controller.AuditController) *UserHandler {
 	return &UserHandler{
 		store:      store,
-		controller: controller}
+		controller: controller,
+		audit:      audit}
 }
 
 func (uh *UserHandler) SignUp(w http.ResponseWriter, r *http.Request) {
@@ -42,11 +47,15 @@ func (uh *UserHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(w, "Username must be at least 3 characters long")
 		return
 	}
-	if !util.PasswordIsValid(user.Password) {
-		io.WriteString(w, "Please choose a stronger password")
+	if strings.Contains(user.Username, "@") {
+		io.WriteString(w, "Username must not contain @")
 		return
 	}
-	user.ProfilePicture = "https://www.testhouse.net/wp-content/uploads/2021/11/default-avatar.jpg"
+	if err := uh.controller.PasswordPolicy.Validate(user.Password); err != nil {
+		io.WriteString(w, err.Error())
+		return
+	}
+	user.ProfilePicture = controller.DefaultProfilePicture
 	if err := uh.controller.CreateAccount(user); err != nil {
 		io.WriteString(w, "Email or username already in use")
 		return
@@ -65,11 +74,7 @@ func (uh *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var user model.User
-	user.Username = r.PostFormValue("username")
-	user.Password = r.PostFormValue("password")
-
-	userInfo, err := uh.controller.SignIn(user)
+	userInfo, err := uh.controller.SignIn(r.PostFormValue("username"), r.PostFormValue("password"))
 	if err != nil {
 		io.WriteString(w, "Incorrect login info")
 		return
@@ -77,6 +82,13 @@ func (uh *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	sess.Values["userID"] = int(userInfo.ID)
 	sess.Values["authenticated"] = true
 	sess.Save(r, w)
+	uh.audit.Record(model.AuditEvent{ActorID: userInfo.ID, ActorUsername: userInfo.Username, Action: controller.AuditLogin, IP: clientIP(r)})
+	if userInfo.DeletionRequestedAt != nil {
+		// Send users back to their account page so they can cancel the deletion.
+		w.Header().Set("HX-Redirect", "/account")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
 	w.Header().Set("HX-Redirect", "/main")
 	w.WriteHeader(http.StatusAccepted)
 }
@@ -133,8 +145,28 @@ func (uh *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	followers, following, err := uh.controller.GetFollowCounts(user.ID)
+	if err != nil {
+		http.Error(w, "Unable to get followers", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		model.User
+		PurgeAt   time.Time
+		Followers int64
+		Following int64
+	}{
+		User:      user,
+		Followers: followers,
+		Following: following,
+	}
+	if user.DeletionRequestedAt != nil {
+		data.PurgeAt = user.DeletionRequestedAt.Add(controller.AccountDeletionGracePeriod)
+	}
+
 	w.Header().Set("Content-Type", "text/html")
-	err = tmpl.Execute(w, user)
+	err = tmpl.Execute(w, data)
 	if err != nil {
 		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
 		return
@@ -177,14 +209,28 @@ func (uh *UserHandler) GetFolders(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Unable to marshal folders", http.StatusInternalServerError)
 		return
 	}
+	unread, err := uh.controller.GetUnreadCounts(userIDInt, folders)
+	if err != nil {
+		http.Error(w, "Unable to get folders", http.StatusInternalServerError)
+		return
+	}
+	unreadJSON, err := json.Marshal(unread)
+	if err != nil {
+		http.Error(w, "Unable to marshal folders", http.StatusInternalServerError)
+		return
+	}
 
 	data := struct {
 		Folders     []model.Folder
 		FoldersJSON template.JS
+		Unread      map[uint]int64
+		UnreadJSON  template.JS
 		HasFolders  bool
 	}{
 		Folders:     folders,
 		FoldersJSON: template.JS(foldersJSON),
+		Unread:      unread,
+		UnreadJSON:  template.JS(unreadJSON),
 		HasFolders:  len(folders) > 0,
 	}
 	w.Header().Set("Content-Type", "text/html")
@@ -224,9 +270,15 @@ func (uh *UserHandler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
 
 	err2 := uh.controller.UpdatePassword(userIDInt, currentPw, newPw)
 	if err2 != nil {
+		var policyErr *util.PasswordError
+		if errors.As(err2, &policyErr) {
+			fmt.Fprintf(w, "<div class='error' data-rule='%s'>%s</div>", policyErr.Rule, template.HTMLEscapeString(policyErr.Message))
+			return
+		}
 		fmt.Fprint(w, "<div class='error'>Unable to update password.</div>")
 		return
 	}
+	uh.audit.Record(model.AuditEvent{ActorID: uint(userIDInt), Action: controller.AuditPasswordChanged, IP: clientIP(r)})
 	w.Header().Set("HX-Redirect", "/account")
 	w.WriteHeader(http.StatusAccepted)
 	fmt.Fprint(w, "<div class='success'>Password successfully updated.</div>")
@@ -251,7 +303,7 @@ func (uh *UserHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err2 := uh.controller.DeleteAccount(userIDInt)
+	err2 := uh.controller.RequestDeletion(userIDInt)
 	if err2 != nil {
 		http.Error(w, "failed to delete account", http.StatusBadRequest)
 		return
@@ -269,3 +321,152 @@ func (uh *UserHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+func (uh *UserHandler) CancelDeletion(w http.ResponseWriter, r *http.Request) {
+	sess, err := uh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	if err := uh.controller.CancelDeletion(userIDInt); err != nil {
+		fmt.Fprint(w, "<div class='error'>Unable to cancel account deletion.</div>")
+		return
+	}
+	w.Header().Set("HX-Redirect", "/account")
+	w.WriteHeader(http.StatusAccepted)
+}
+func (uh *UserHandler) GetFollowButton(w http.ResponseWriter, r *http.Request) {
+	uh.follow(w, r, nil)
+}
+func (uh *UserHandler) Follow(w http.ResponseWriter, r *http.Request) {
+	uh.follow(w, r, uh.controller.Follow)
+}
+func (uh *UserHandler) Unfollow(w http.ResponseWriter, r *http.Request) {
+	uh.follow(w, r, uh.controller.Unfollow)
+}
+
+// follow applies fn, if any, to the user named in the path and renders the
+// follow button for them in its new state.
+func (uh *UserHandler) follow(w http.ResponseWriter, r *http.Request, fn func(followerID int, username string) (model.User, error)) {
+	sess, err := uh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	username := r.PathValue("username")
+	if fn != nil {
+		if _, err := fn(userIDInt, username); err != nil {
+			http.Error(w, "Unable to update follow", http.StatusBadRequest)
+			return
+		}
+	}
+	user, err := uh.controller.GetUserByUsername(username)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	following, err := uh.controller.IsFollowing(userIDInt, user.ID)
+	if err != nil {
+		http.Error(w, "Unable to get followers", http.StatusInternalServerError)
+		return
+	}
+	followers, _, err := uh.controller.GetFollowCounts(user.ID)
+	if err != nil {
+		http.Error(w, "Unable to get followers", http.StatusInternalServerError)
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "followButton.html")
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Username  string
+		Self      bool
+		Following bool
+		Followers int64
+	}{
+		Username:  user.Username,
+		Self:      user.ID == uint(userIDInt),
+		Following: following,
+		Followers: followers,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
+func (uh *UserHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := uh.controller.GetProfile(r.PathValue("username"))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(profile); err != nil {
+			http.Error(w, "Unable to marshal profile", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "profile.html")
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+
+	foldersJSON, err := json.Marshal(profile.Folders)
+	if err != nil {
+		http.Error(w, "Unable to marshal folders", http.StatusInternalServerError)
+		return
+	}
+
+	sess, _ := uh.store.Get(r, "twilu-cookie")
+	_, signedIn := sess.Values["userID"].(int)
+
+	data := struct {
+		controller.Profile
+		FoldersJSON template.JS
+		SignedIn    bool
+	}{
+		Profile:     profile,
+		FoldersJSON: template.JS(foldersJSON),
+		SignedIn:    signedIn,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
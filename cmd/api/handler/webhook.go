@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"github.com/gorilla/sessions"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"twilu/internal/controller"
+	"twilu/internal/model"
+)
+
+type WebhookHandler struct {
+	store      *sessions.CookieStore
+	controller *controller.WebhookController
+}
+
+func NewWebhookHandler(store *sessions.CookieStore, controller *controller.WebhookController) *WebhookHandler {
+	return &WebhookHandler{
+		store:      store,
+		controller: controller}
+}
+
+func (wh *WebhookHandler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	sess, err := wh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	wh.renderWebhooks(w, folderID, userIDInt, model.Webhook{}, "", "")
+}
+func (wh *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing the form", http.StatusInternalServerError)
+		return
+	}
+	sess, err := wh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	folderID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	webhook, err := wh.controller.CreateWebhook(folderID, userIDInt, r.PostFormValue("url"))
+	if err != nil {
+		wh.renderWebhooks(w, folderID, userIDInt, model.Webhook{}, "", "Unable to create webhook: "+err.Error())
+		return
+	}
+	wh.renderWebhooks(w, folderID, userIDInt, webhook, "", "")
+}
+func (wh *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	sess, err := wh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	webhookID, err := strconv.Atoi(r.PathValue("webhookID"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	webhook, err := wh.controller.DeleteWebhook(webhookID, userIDInt)
+	if err != nil {
+		http.Error(w, "unable to delete webhook", http.StatusBadGateway)
+		return
+	}
+	wh.renderWebhooks(w, int(webhook.FolderID), userIDInt, model.Webhook{}, "", "")
+}
+func (wh *WebhookHandler) Ping(w http.ResponseWriter, r *http.Request) {
+	sess, err := wh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	webhookID, err := strconv.Atoi(r.PathValue("webhookID"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	webhook, err := wh.controller.Ping(webhookID, userIDInt)
+	if err != nil {
+		http.Error(w, "unable to ping webhook", http.StatusBadGateway)
+		return
+	}
+	wh.renderWebhooks(w, int(webhook.FolderID), userIDInt, model.Webhook{}, "Ping queued, it will show up in the deliveries shortly.", "")
+}
+func (wh *WebhookHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	sess, err := wh.store.Get(r, "twilu-cookie")
+	if err != nil {
+		http.Error(w, "Bad session", http.StatusBadGateway)
+		return
+	}
+
+	userID, ok := sess.Values["userID"]
+	if !ok {
+		http.Error(w, "User ID not found in session", http.StatusBadRequest)
+		return
+	}
+
+	userIDInt, ok := userID.(int)
+	if !ok {
+		http.Error(w, "User ID is of invalid type", http.StatusBadRequest)
+		return
+	}
+
+	webhookID, err := strconv.Atoi(r.PathValue("webhookID"))
+	if err != nil {
+		http.Error(w, "unable to convert id", http.StatusBadGateway)
+		return
+	}
+	webhook, deliveries, err := wh.controller.GetDeliveries(webhookID, userIDInt)
+	if err != nil {
+		http.Error(w, "unable to get deliveries", http.StatusForbidden)
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "webhookDeliveries.html")
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		Webhook    model.Webhook
+		Deliveries []model.WebhookDelivery
+	}{
+		Webhook:    webhook,
+		Deliveries: deliveries,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
+
+// renderWebhooks writes the webhook list partial of a folder. The secret of a
+// new webhook is only shown in the response to the request that created it.
+func (wh *WebhookHandler) renderWebhooks(w http.ResponseWriter, folderID int, userID int, created model.Webhook, message string, errMsg string) {
+	webhooks, err := wh.controller.GetWebhooks(folderID, userID)
+	if err != nil {
+		http.Error(w, "Unable to get webhooks", http.StatusForbidden)
+		return
+	}
+
+	tmplPath := filepath.Join("./internal/web/templates", "webhooks.html")
+	tmpl, err := template.ParseFiles(tmplPath)
+	if err != nil {
+		http.Error(w, "Unable to load template", http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		FolderID  int
+		Webhooks  []model.Webhook
+		NewSecret string
+		Message   string
+		Error     string
+	}{
+		FolderID:  folderID,
+		Webhooks:  webhooks,
+		NewSecret: created.Secret,
+		Message:   message,
+		Error:     errMsg,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "Unable to execute template", http.StatusInternalServerError)
+		return
+	}
+}
@@ -6,10 +6,14 @@ import (
 	"net/http"
 	"os"
 	"text/template"
+	"time"
 	"twilu/cmd/api/handler"
 	"twilu/internal/cfg"
 	"twilu/internal/controller"
 	"twilu/internal/database"
+	"twilu/internal/job"
+	"twilu/internal/oidc"
+	"twilu/internal/realtime"
 )
 
 func main() {
@@ -18,13 +22,42 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	userController := controller.NewUserController(db)
-	itemController := controller.NewItemController(db)
+	userController := controller.NewUserController(db, cfg.LoadPasswordPolicy(), cfg.LoadMailer())
+	events := realtime.NewBroker()
+	itemController := controller.NewItemController(db, events)
 	folderController := controller.NewFolderController(db)
+	tokenController := controller.NewTokenController(db)
+	trashController := controller.NewTrashController(db, cfg.LoadTrashRetention())
+	auditController := controller.NewAuditController(db)
+	commentController := controller.NewCommentController(db)
+	notificationController := controller.NewNotificationController(db)
+	linkController := controller.NewLinkController(db)
+	webhookController := controller.NewWebhookController(db)
+	subscriptionController := controller.NewSubscriptionController(db, itemController)
+	smartFolderController := controller.NewSmartFolderController(db)
 
-	userHandler := handler.NewUserHandler(store, userController)
-	itemHandler := handler.NewItemHandler(store, itemController)
-	folderHandler := handler.NewFolderHandler(store, folderController)
+	userHandler := handler.NewUserHandler(store, userController, auditController)
+	itemHandler := handler.NewItemHandler(store, itemController, auditController)
+	folderHandler := handler.NewFolderHandler(store, folderController, auditController)
+	tokenHandler := handler.NewTokenHandler(store, tokenController)
+	tokenAuth := handler.NewTokenAuth(store, tokenController)
+	trashHandler := handler.NewTrashHandler(store, trashController)
+	auditHandler := handler.NewAuditHandler(store, auditController)
+	commentHandler := handler.NewCommentHandler(store, commentController)
+	notificationHandler := handler.NewNotificationHandler(store, notificationController)
+	eventsHandler := handler.NewEventsHandler(store, folderController, events)
+	webhookHandler := handler.NewWebhookHandler(store, webhookController)
+	feedHandler := handler.NewFeedHandler(folderController, userController)
+	subscriptionHandler := handler.NewSubscriptionHandler(store, subscriptionController)
+	smartFolderHandler := handler.NewSmartFolderHandler(store, smartFolderController)
+
+	oidcConfig, ssoEnabled := cfg.LoadOIDCConfig()
+
+	job.Every("purge-deleted-accounts", time.Hour, userController.PurgeDeletedAccounts)
+	job.Every("purge-trash", time.Hour, trashController.PurgeExpired)
+	job.Every("check-links", time.Hour, linkController.CheckLinks)
+	job.Every("deliver-webhooks", time.Minute, webhookController.DeliverPending)
+	job.Every("poll-feeds", 5*time.Minute, subscriptionController.PollFeeds)
 
 	mux := http.NewServeMux()
 	mux.Handle("/internal/web", http.StripPrefix("/internal/web", http.FileServer(http.Dir("./internal/web"))))
@@ -37,7 +70,8 @@ func main() {
 			return
 		}
 		templates := template.Must(template.ParseFiles("internal/web/client/login.html"))
-		if err := templates.ExecuteTemplate(w, "login.html", nil); err != nil {
+		data := struct{ SSOEnabled bool }{SSOEnabled: ssoEnabled}
+		if err := templates.ExecuteTemplate(w, "login.html", data); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	})
@@ -70,6 +104,18 @@ func main() {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	})
+	mux.HandleFunc("/smart/{id}", func(w http.ResponseWriter, r *http.Request) {
+		sess, _ := store.Get(r, "twilu-cookie")
+		if auth, ok := sess.Values["authenticated"].(bool); !ok || !auth {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+
+		templates := template.Must(template.ParseFiles("internal/web/client/folderPage.html"))
+		if err := templates.ExecuteTemplate(w, "folderPage.html", nil); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
 	mux.HandleFunc("/social", func(w http.ResponseWriter, r *http.Request) {
 		sess, _ := store.Get(r, "twilu-cookie")
 		if auth, ok := sess.Values["authenticated"].(bool); !ok || !auth {
@@ -94,21 +140,147 @@ func main() {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	})
+	mux.HandleFunc("/u/{username}", func(w http.ResponseWriter, r *http.Request) {
+		templates := template.Must(template.ParseFiles("internal/web/client/profilePage.html"))
+		if err := templates.ExecuteTemplate(w, "profilePage.html", nil); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("GET /folder/{id}/feed.xml", feedHandler.FolderAtom)
+	mux.HandleFunc("GET /folder/{id}/rss.xml", feedHandler.FolderRSS)
+	mux.HandleFunc("GET /folder/{id}/feed.json", feedHandler.FolderJSON)
+	mux.HandleFunc("GET /u/{username}/feed.xml", feedHandler.UserAtom)
+	mux.HandleFunc("GET /u/{username}/rss.xml", feedHandler.UserRSS)
+	mux.HandleFunc("GET /u/{username}/feed.json", feedHandler.UserJSON)
+	mux.HandleFunc("/quicksave", func(w http.ResponseWriter, r *http.Request) {
+		// The bookmarklet opens this page from another site, so the SameSite=Strict
+		// login cookie isn't sent with it and redirecting to the login page would
+		// lose the url and title. The popup's own requests are same-site and carry
+		// the cookie, and the popup asks the user to sign in if they fail.
+		templates := template.Must(template.ParseFiles("internal/web/client/quickSave.html"))
+		if err := templates.ExecuteTemplate(w, "quickSave.html", nil); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("/inbox", func(w http.ResponseWriter, r *http.Request) {
+		sess, _ := store.Get(r, "twilu-cookie")
+		if auth, ok := sess.Values["authenticated"].(bool); !ok || !auth {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+
+		templates := template.Must(template.ParseFiles("internal/web/client/inboxPage.html"))
+		if err := templates.ExecuteTemplate(w, "inboxPage.html", nil); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("/trash", func(w http.ResponseWriter, r *http.Request) {
+		sess, _ := store.Get(r, "twilu-cookie")
+		if auth, ok := sess.Values["authenticated"].(bool); !ok || !auth {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+
+		templates := template.Must(template.ParseFiles("internal/web/client/trashPage.html"))
+		if err := templates.ExecuteTemplate(w, "trashPage.html", nil); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("/notifications", func(w http.ResponseWriter, r *http.Request) {
+		sess, _ := store.Get(r, "twilu-cookie")
+		if auth, ok := sess.Values["authenticated"].(bool); !ok || !auth {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+
+		templates := template.Must(template.ParseFiles("internal/web/client/notificationsPage.html"))
+		if err := templates.ExecuteTemplate(w, "notificationsPage.html", nil); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
 
 	// api routes
 	mux.HandleFunc("POST /api/signup", userHandler.SignUp)
 	mux.HandleFunc("POST /api/login", userHandler.Login)
 	mux.HandleFunc("POST /api/logout", userHandler.Logout)
-	mux.HandleFunc("GET /api/user/folders", userHandler.GetFolders)
-	mux.HandleFunc("POST /api/folder/create", folderHandler.CreateFolder)
-	mux.HandleFunc("GET /api/folder/{id}", folderHandler.GetFolder)
-	mux.HandleFunc("DELETE /api/folder/{id}", folderHandler.DeleteFolder)
-	mux.HandleFunc("POST /api/folder/{id}/add", itemHandler.AddItem)
-	mux.HandleFunc("DELETE /api/folder/{id}/item/{itemID}", itemHandler.DeleteItem)
+	mux.HandleFunc("GET /api/user/folders", tokenAuth.Require(controller.ScopeFoldersRead, userHandler.GetFolders))
+	mux.HandleFunc("POST /api/folder/create", tokenAuth.Require(controller.ScopeFoldersWrite, folderHandler.CreateFolder))
+	mux.HandleFunc("GET /api/folder/{id}", tokenAuth.Require(controller.ScopeFoldersRead, folderHandler.GetFolder))
+	mux.HandleFunc("DELETE /api/folder/{id}", tokenAuth.Require(controller.ScopeFoldersWrite, folderHandler.DeleteFolder))
+	mux.HandleFunc("PUT /api/folder/{id}", tokenAuth.Require(controller.ScopeFoldersWrite, folderHandler.UpdateFolder))
+	mux.HandleFunc("GET /api/folder/{id}/events", eventsHandler.Stream)
+	mux.HandleFunc("GET /api/folder/{id}/activity", tokenAuth.Require(controller.ScopeFoldersRead, folderHandler.GetActivity))
+	mux.HandleFunc("POST /api/folder/{id}/add", tokenAuth.Require(controller.ScopeItemsWrite, itemHandler.AddItem))
+	mux.HandleFunc("DELETE /api/folder/{id}/item/{itemID}", tokenAuth.Require(controller.ScopeItemsWrite, itemHandler.DeleteItem))
+	mux.HandleFunc("PUT /api/folder/{id}/item/{itemID}", tokenAuth.Require(controller.ScopeItemsWrite, itemHandler.RenameItem))
 	mux.HandleFunc("DELETE /api/user", userHandler.DeleteAccount)
-	mux.HandleFunc("GET /api/feed", folderHandler.GetFeed)
-	mux.HandleFunc("GET /api/user", userHandler.GetUser)
+	mux.HandleFunc("GET /api/feed", tokenAuth.Require(controller.ScopeFoldersRead, folderHandler.GetFeed))
+	mux.HandleFunc("GET /api/user/saved", tokenAuth.Require(controller.ScopeFoldersRead, folderHandler.GetSavedFolders))
+	mux.HandleFunc("GET /api/folder/{id}/reactions", folderHandler.GetReactions)
+	mux.HandleFunc("GET /api/notifications", tokenAuth.Require(controller.ScopeAccountRead, notificationHandler.GetNotifications))
+	mux.HandleFunc("GET /api/notifications/unread", notificationHandler.GetUnreadCount)
+	mux.HandleFunc("POST /api/notifications/read", notificationHandler.MarkAllRead)
+	mux.HandleFunc("POST /api/notifications/{id}/read", notificationHandler.MarkRead)
+	mux.HandleFunc("GET /api/notifications/preferences", notificationHandler.GetPreferences)
+	mux.HandleFunc("POST /api/notifications/preferences", notificationHandler.UpdatePreferences)
+	mux.HandleFunc("GET /api/folder/{id}/comments", commentHandler.GetComments)
+	mux.HandleFunc("POST /api/folder/{id}/comments", commentHandler.AddComment)
+	mux.HandleFunc("PUT /api/comments/{commentID}", commentHandler.EditComment)
+	mux.HandleFunc("DELETE /api/comments/{commentID}", commentHandler.DeleteComment)
+	mux.HandleFunc("GET /api/folder/{id}/webhooks", webhookHandler.GetWebhooks)
+	mux.HandleFunc("POST /api/folder/{id}/webhooks", webhookHandler.CreateWebhook)
+	mux.HandleFunc("DELETE /api/webhooks/{webhookID}", webhookHandler.DeleteWebhook)
+	mux.HandleFunc("POST /api/webhooks/{webhookID}/ping", webhookHandler.Ping)
+	mux.HandleFunc("GET /api/webhooks/{webhookID}/deliveries", webhookHandler.GetDeliveries)
+	mux.HandleFunc("GET /api/folder/{id}/subscriptions", subscriptionHandler.GetSubscriptions)
+	mux.HandleFunc("POST /api/folder/{id}/subscriptions", subscriptionHandler.Subscribe)
+	mux.HandleFunc("DELETE /api/subscriptions/{subscriptionID}", subscriptionHandler.Unsubscribe)
+	mux.HandleFunc("GET /api/inbox", itemHandler.GetInbox)
+	mux.HandleFunc("POST /api/inbox", tokenAuth.Require(controller.ScopeItemsWrite, itemHandler.AddToInbox))
+	mux.HandleFunc("PUT /api/folder/{id}/item/{itemID}/notes", tokenAuth.Require(controller.ScopeItemsWrite, itemHandler.UpdateNotes))
+	mux.HandleFunc("PUT /api/folder/{id}/item/{itemID}/state", tokenAuth.Require(controller.ScopeItemsWrite, itemHandler.SetItemState))
+	mux.HandleFunc("POST /api/folder/{id}/read", tokenAuth.Require(controller.ScopeItemsWrite, itemHandler.MarkAllRead))
+	mux.HandleFunc("GET /api/search", tokenAuth.Require(controller.ScopeFoldersRead, itemHandler.SearchItems))
+	mux.HandleFunc("POST /api/folder/{id}/item/{itemID}/move", tokenAuth.Require(controller.ScopeItemsWrite, itemHandler.MoveItem))
+	mux.HandleFunc("GET /api/quicksave/folders", tokenAuth.Require(controller.ScopeFoldersRead, itemHandler.GetQuickSaveFolders))
+	mux.HandleFunc("POST /api/quicksave", tokenAuth.Require(controller.ScopeItemsWrite, itemHandler.QuickSave))
+	mux.HandleFunc("POST /api/folder/{id}/move", tokenAuth.Require(controller.ScopeFoldersWrite, folderHandler.MoveFolder))
+	mux.HandleFunc("GET /api/folder/{id}/export", tokenAuth.Require(controller.ScopeFoldersRead, folderHandler.ExportFolder))
+	mux.HandleFunc("GET /api/user/smart", smartFolderHandler.GetSmartFolders)
+	mux.HandleFunc("POST /api/smart", smartFolderHandler.CreateSmartFolder)
+	mux.HandleFunc("GET /api/smart/{id}", smartFolderHandler.GetSmartFolder)
+	mux.HandleFunc("PUT /api/smart/{id}", smartFolderHandler.UpdateSmartFolder)
+	mux.HandleFunc("DELETE /api/smart/{id}", smartFolderHandler.DeleteSmartFolder)
+	mux.HandleFunc("POST /api/folder/{id}/clone", tokenAuth.Require(controller.ScopeFoldersWrite, folderHandler.CloneFolder))
+	mux.HandleFunc("POST /api/folder/{id}/like", folderHandler.Like)
+	mux.HandleFunc("DELETE /api/folder/{id}/like", folderHandler.Unlike)
+	mux.HandleFunc("POST /api/folder/{id}/save", folderHandler.Save)
+	mux.HandleFunc("DELETE /api/folder/{id}/save", folderHandler.Unsave)
+	mux.HandleFunc("GET /api/feed/following", tokenAuth.Require(controller.ScopeFoldersRead, folderHandler.GetFollowingFeed))
+	mux.HandleFunc("GET /api/u/{username}", userHandler.GetProfile)
+	mux.HandleFunc("GET /api/user/{username}/follow", userHandler.GetFollowButton)
+	mux.HandleFunc("POST /api/user/{username}/follow", userHandler.Follow)
+	mux.HandleFunc("DELETE /api/user/{username}/follow", userHandler.Unfollow)
+	mux.HandleFunc("GET /api/user", tokenAuth.Require(controller.ScopeAccountRead, userHandler.GetUser))
 	mux.HandleFunc("POST /api/password/update", userHandler.UpdatePassword)
+	mux.HandleFunc("POST /api/user/restore", userHandler.CancelDeletion)
+	mux.HandleFunc("GET /api/tokens", tokenHandler.GetTokens)
+	mux.HandleFunc("POST /api/tokens", tokenHandler.CreateToken)
+	mux.HandleFunc("DELETE /api/tokens/{id}", tokenHandler.DeleteToken)
+	mux.HandleFunc("GET /api/trash", trashHandler.GetTrash)
+	mux.HandleFunc("POST /api/trash/folder/{id}/restore", trashHandler.RestoreFolder)
+	mux.HandleFunc("DELETE /api/trash/folder/{id}", trashHandler.PurgeFolder)
+	mux.HandleFunc("POST /api/trash/item/{id}/restore", trashHandler.RestoreItem)
+	mux.HandleFunc("DELETE /api/trash/item/{id}", trashHandler.PurgeItem)
+	mux.HandleFunc("GET /api/audit", tokenAuth.Require(controller.ScopeAccountRead, auditHandler.GetUserEvents))
+	mux.HandleFunc("GET /api/folder/{id}/audit", tokenAuth.Require(controller.ScopeFoldersRead, auditHandler.GetFolderEvents))
+	mux.HandleFunc("POST /api/folder/{id}/contributors", tokenAuth.Require(controller.ScopeFoldersWrite, folderHandler.AddContributor))
+	mux.HandleFunc("DELETE /api/folder/{id}/contributors/{userID}", tokenAuth.Require(controller.ScopeFoldersWrite, folderHandler.RemoveContributor))
+	if ssoEnabled {
+		oidcHandler := handler.NewOIDCHandler(store, userController, auditController, oidc.NewProvider(oidcConfig))
+		mux.HandleFunc("GET /auth/oidc/login", oidcHandler.Login)
+		mux.HandleFunc("GET /auth/oidc/callback", oidcHandler.Callback)
+	}
 	port := os.Getenv("PORT")
 	portStr := fmt.Sprintf("0.0.0.0:%s", port)
 	log.Fatal(http.ListenAndServe(portStr, mux))
@@ -0,0 +1,30 @@
+package cfg
+
+import (
+	"net"
+	"net/smtp"
+	"os"
+	"twilu/internal/mail"
+)
+
+// LoadMailer returns an SMTP mailer when SMTP_HOST is set, otherwise a mailer
+// that only logs messages.
+func LoadMailer() mail.Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return mail.LogMailer{}
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "twilu@" + host
+	}
+	mailer := &mail.SMTPMailer{Addr: net.JoinHostPort(host, port), From: from}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		mailer.Auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return mailer
+}
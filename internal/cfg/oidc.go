@@ -0,0 +1,30 @@
+package cfg
+
+import (
+	"log"
+	"os"
+	"strings"
+	"twilu/internal/oidc"
+)
+
+// LoadOIDCConfig reads the single sign-on settings from the environment.
+// SSO is disabled, and ok is false, unless OIDC_ISSUER is set.
+func LoadOIDCConfig() (config oidc.Config, ok bool) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return oidc.Config{}, false
+	}
+	config = oidc.Config{
+		Issuer:       issuer,
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+	}
+	if config.ClientID == "" || config.RedirectURL == "" {
+		log.Fatal("OIDC_CLIENT_ID and OIDC_REDIRECT_URL must be set when OIDC_ISSUER is set")
+	}
+	if scopes := os.Getenv("OIDC_SCOPES"); scopes != "" {
+		config.Scopes = strings.Fields(scopes)
+	}
+	return config, true
+}
@@ -0,0 +1,57 @@
+package cfg
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"twilu/internal/util"
+)
+
+// LoadPasswordPolicy builds the password policy from the environment, falling
+// back to util.DefaultPasswordPolicy for anything left unset.
+func LoadPasswordPolicy() util.PasswordPolicy {
+	policy := util.DefaultPasswordPolicy()
+
+	if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatal("PASSWORD_MIN_LENGTH must be a positive number")
+		}
+		policy.MinLength = n
+	}
+	if v := os.Getenv("PASSWORD_PASSPHRASE_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatal("PASSWORD_PASSPHRASE_LENGTH must be zero or a positive number")
+		}
+		policy.PassphraseLength = n
+	}
+	if v, ok := os.LookupEnv("PASSWORD_REQUIRE"); ok {
+		policy.RequireUpper, policy.RequireLower, policy.RequireDigit, policy.RequireSpecial = false, false, false, false
+		for _, class := range strings.Split(v, ",") {
+			switch strings.TrimSpace(class) {
+			case "":
+			case "upper":
+				policy.RequireUpper = true
+			case "lower":
+				policy.RequireLower = true
+			case "digit":
+				policy.RequireDigit = true
+			case "special":
+				policy.RequireSpecial = true
+			default:
+				log.Fatalf("PASSWORD_REQUIRE: unknown character class %q", class)
+			}
+		}
+	}
+	if path := os.Getenv("PASSWORD_BREACHED_LIST"); path != "" {
+		list, err := util.LoadBreachedList(path)
+		if err != nil {
+			log.Fatalf("unable to load breached password list: %v", err)
+		}
+		log.Printf("loaded %d breached password hashes", list.Len())
+		policy.Breached = list
+	}
+	return policy
+}
@@ -0,0 +1,22 @@
+package cfg
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// LoadTrashRetention returns how long deleted folders and items stay in the
+// trash, from TRASH_RETENTION_DAYS. It defaults to 30 days.
+func LoadTrashRetention() time.Duration {
+	days := 30
+	if v := os.Getenv("TRASH_RETENTION_DAYS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatal("TRASH_RETENTION_DAYS must be a positive number")
+		}
+		days = n
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"twilu/internal/model"
+)
+
+// Kinds of folder activity.
+const (
+	ActivityItemAdded      = "item_added"
+	ActivityItemRemoved    = "item_removed"
+	ActivityItemRenamed    = "item_renamed"
+	ActivityItemMoved      = "item_moved"
+	ActivityFolderRenamed  = "folder_renamed"
+	ActivityPrivacyChanged = "privacy_changed"
+	ActivityFolderCloned   = "folder_cloned"
+)
+
+// activityPageSize caps how many entries a folder's activity feed returns.
+const activityPageSize = 100
+
+// recordActivity adds an entry to the folder's activity feed. It runs inside
+// the write's transaction so the feed never disagrees with the folder.
+func recordActivity(tx *gorm.DB, activity model.FolderActivity) error {
+	if err := tx.Create(&activity).Error; err != nil {
+		return fmt.Errorf("unable to record activity: %w", err)
+	}
+	return nil
+}
+
+// canViewFolder reports whether the user may see the folder: public folders
+// are visible to everyone, private ones to their owner and contributors.
+func canViewFolder(tx *gorm.DB, folder model.Folder, userID int) (bool, error) {
+	if !folder.Private || folder.Owner == uint(userID) {
+		return true, nil
+	}
+	return isContributor(tx, folder.ID, userID)
+}
+
+// isContributor reports whether the user was added as a contributor to the folder.
+func isContributor(tx *gorm.DB, folderID uint, userID int) (bool, error) {
+	var count int64
+	if err := tx.Table("folder_contributors").
+		Where("folder_id = ? AND user_id = ?", folderID, userID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
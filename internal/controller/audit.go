@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"twilu/internal/model"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditLogin              = "login"
+	AuditPasswordChanged    = "password_changed"
+	AuditFolderCreated      = "folder_created"
+	AuditFolderDeleted      = "folder_deleted"
+	AuditFolderCloned       = "folder_cloned"
+	AuditFolderMoved        = "folder_moved"
+	AuditItemAdded          = "item_added"
+	AuditItemDeleted        = "item_deleted"
+	AuditItemMoved          = "item_moved"
+	AuditContributorAdded   = "contributor_added"
+	AuditContributorRemoved = "contributor_removed"
+)
+
+// auditPageSize caps how many events a single query returns.
+const auditPageSize = 200
+
+// AuditController records and queries the audit log.
+type AuditController struct {
+	DB *gorm.DB
+}
+
+// NewAuditController creates a new instance of AuditController.
+func NewAuditController(db *gorm.DB) *AuditController {
+	return &AuditController{DB: db}
+}
+
+// Record stores an audit event. Failures are logged rather than returned so
+// that auditing never undoes an action that already succeeded.
+func (ac *AuditController) Record(event model.AuditEvent) {
+	if event.ActorUsername == "" {
+		var actor model.User
+		if err := ac.DB.Unscoped().Select("username").First(&actor, event.ActorID).Error; err == nil {
+			event.ActorUsername = actor.Username
+		}
+	}
+	if err := ac.DB.Create(&event).Error; err != nil {
+		log.Printf("unable to record audit event %s: %v", event.Action, err)
+	}
+}
+
+// GetUserEvents returns events performed by the user or done to their account.
+func (ac *AuditController) GetUserEvents(userID int) ([]model.AuditEvent, error) {
+	var events []model.AuditEvent
+	if err := ac.DB.Where("actor_id = ? OR subject_user_id = ?", userID, userID).
+		Order("created_at DESC").
+		Limit(auditPageSize).
+		Find(&events).Error; err != nil {
+		return []model.AuditEvent{}, err
+	}
+	return events, nil
+}
+
+// GetFolderEvents returns the events of a folder. Only its owner may see them.
+func (ac *AuditController) GetFolderEvents(folderID int, userID int) ([]model.AuditEvent, error) {
+	var folder model.Folder
+	if err := ac.DB.Unscoped().First(&folder, folderID).Error; err != nil {
+		return []model.AuditEvent{}, fmt.Errorf("folder not found: %w", err)
+	}
+	if folder.Owner != uint(userID) {
+		return []model.AuditEvent{}, fmt.Errorf("user is not the owner")
+	}
+	var events []model.AuditEvent
+	if err := ac.DB.Where("folder_id = ?", folderID).
+		Order("created_at DESC").
+		Limit(auditPageSize).
+		Find(&events).Error; err != nil {
+		return []model.AuditEvent{}, err
+	}
+	return events, nil
+}
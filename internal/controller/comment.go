@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+	"twilu/internal/model"
+)
+
+// maxCommentLength caps the length of a comment's body.
+const maxCommentLength = 2000
+
+// CommentController handles comments on folders and items.
+type CommentController struct {
+	DB *gorm.DB
+}
+
+// NewCommentController creates a new instance of CommentController.
+func NewCommentController(db *gorm.DB) *CommentController {
+	return &CommentController{DB: db}
+}
+
+// CommentThread is a comment with its replies, and what the viewing user is
+// allowed to do with it.
+type CommentThread struct {
+	model.Comment
+	Replies   []*CommentThread
+	CanEdit   bool
+	CanDelete bool
+}
+
+// GetComments returns the comments on a folder the user can view, or on one
+// of its items if itemID is not zero, as threads in the order they were posted.
+func (cc *CommentController) GetComments(folderID int, itemID int, userID int) ([]*CommentThread, error) {
+	var folder model.Folder
+	if err := cc.DB.First(&folder, folderID).Error; err != nil {
+		return nil, fmt.Errorf("folder not found: %w", err)
+	}
+	ok, err := canViewFolder(cc.DB, folder, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("user does not have permission to do that")
+	}
+
+	query := cc.DB.Where("folder_id = ?", folder.ID)
+	if itemID != 0 {
+		query = query.Where("item_id = ?", itemID)
+	} else {
+		query = query.Where("item_id IS NULL")
+	}
+	var comments []model.Comment
+	if err := query.Order("created_at ASC").Find(&comments).Error; err != nil {
+		return nil, err
+	}
+
+	threads := make(map[uint]*CommentThread, len(comments))
+	for _, comment := range comments {
+		threads[comment.ID] = &CommentThread{
+			Comment:   comment,
+			CanEdit:   !comment.Removed && comment.AuthorID == uint(userID),
+			CanDelete: !comment.Removed && (comment.AuthorID == uint(userID) || folder.Owner == uint(userID)),
+		}
+	}
+	var roots []*CommentThread
+	for _, comment := range comments {
+		thread := threads[comment.ID]
+		if comment.ParentID != nil {
+			if parent, ok := threads[*comment.ParentID]; ok {
+				parent.Replies = append(parent.Replies, thread)
+				continue
+			}
+		}
+		roots = append(roots, thread)
+	}
+	return roots, nil
+}
+
+// AddComment posts comment on behalf of the user, who must be able to view
+// the folder. A reply must be on the same folder or item as its parent.
+func (cc *CommentController) AddComment(comment model.Comment, userID int) (model.Comment, error) {
+	body, err := commentBody(comment.Body)
+	if err != nil {
+		return model.Comment{}, err
+	}
+	err = cc.DB.Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return fmt.Errorf("user not found: %w", err)
+		}
+		var folder model.Folder
+		if err := tx.First(&folder, comment.FolderID).Error; err != nil {
+			return fmt.Errorf("folder not found: %w", err)
+		}
+		ok, err := canViewFolder(tx, folder, userID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("user does not have permission to do that")
+		}
+		if comment.ItemID != nil {
+			var item model.Item
+			if err := tx.Where("folder_id = ?", folder.ID).First(&item, *comment.ItemID).Error; err != nil {
+				return fmt.Errorf("item not found: %w", err)
+			}
+		}
+		var parent model.Comment
+		if comment.ParentID != nil {
+			if err := tx.Where("folder_id = ?", folder.ID).First(&parent, *comment.ParentID).Error; err != nil {
+				return fmt.Errorf("comment not found: %w", err)
+			}
+			if (parent.ItemID == nil) != (comment.ItemID == nil) ||
+				(parent.ItemID != nil && *parent.ItemID != *comment.ItemID) {
+				return fmt.Errorf("a reply must be on the same item as its comment")
+			}
+		}
+
+		comment = model.Comment{
+			FolderID:       folder.ID,
+			ItemID:         comment.ItemID,
+			ParentID:       comment.ParentID,
+			AuthorID:       user.ID,
+			AuthorUsername: user.Username,
+			Body:           body,
+		}
+		if err := tx.Create(&comment).Error; err != nil {
+			return fmt.Errorf("unable to add comment: %w", err)
+		}
+		if parent.ID == 0 || parent.Removed || parent.AuthorID == user.ID {
+			return nil
+		}
+		return notify(tx, model.Notification{
+			UserID:        parent.AuthorID,
+			Kind:          NotifyCommentReply,
+			ActorUsername: user.Username,
+			FolderID:      &folder.ID,
+			ItemID:        comment.ItemID,
+			CommentID:     &comment.ID,
+			Subject:       folder.Name,
+		})
+	})
+	if err != nil {
+		return model.Comment{}, err
+	}
+	return comment, nil
+}
+
+// EditComment changes the body of one of the user's own comments.
+func (cc *CommentController) EditComment(commentID int, userID int, body string) (model.Comment, error) {
+	body, err := commentBody(body)
+	if err != nil {
+		return model.Comment{}, err
+	}
+	var comment model.Comment
+	if err := cc.DB.First(&comment, commentID).Error; err != nil {
+		return model.Comment{}, fmt.Errorf("comment not found: %w", err)
+	}
+	if comment.AuthorID != uint(userID) || comment.Removed {
+		return model.Comment{}, fmt.Errorf("user is not the author")
+	}
+	// Authors who can no longer see the folder can't edit their comments there.
+	var folder model.Folder
+	if err := cc.DB.First(&folder, comment.FolderID).Error; err != nil {
+		return model.Comment{}, fmt.Errorf("folder not found: %w", err)
+	}
+	ok, err := canViewFolder(cc.DB, folder, userID)
+	if err != nil {
+		return model.Comment{}, err
+	}
+	if !ok {
+		return model.Comment{}, fmt.Errorf("user does not have permission to do that")
+	}
+	now := time.Now()
+	if err := cc.DB.Model(&comment).Updates(model.Comment{Body: body, EditedAt: &now}).Error; err != nil {
+		return model.Comment{}, fmt.Errorf("unable to edit comment: %w", err)
+	}
+	return comment, nil
+}
+
+// DeleteComment removes a comment. Authors can delete their own comments and
+// folder owners can delete any comment on their folder. A comment that has
+// replies is blanked rather than deleted so the thread stays intact.
+func (cc *CommentController) DeleteComment(commentID int, userID int) (model.Comment, error) {
+	var comment model.Comment
+	err := cc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&comment, commentID).Error; err != nil {
+			return fmt.Errorf("comment not found: %w", err)
+		}
+		if comment.AuthorID != uint(userID) {
+			var folder model.Folder
+			if err := tx.First(&folder, comment.FolderID).Error; err != nil {
+				return fmt.Errorf("folder not found: %w", err)
+			}
+			if folder.Owner != uint(userID) {
+				return fmt.Errorf("user does not have permission to do that")
+			}
+		}
+		var replies int64
+		if err := tx.Model(&model.Comment{}).Where("parent_id = ?", comment.ID).Count(&replies).Error; err != nil {
+			return err
+		}
+		if replies > 0 {
+			return tx.Model(&comment).Select("Body", "Removed").Updates(model.Comment{Body: "", Removed: true}).Error
+		}
+		return tx.Delete(&comment).Error
+	})
+	if err != nil {
+		return model.Comment{}, err
+	}
+	return comment, nil
+}
+
+// commentBody trims a comment's body and checks its length.
+func commentBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", fmt.Errorf("comment must not be blank")
+	}
+	if len(body) > maxCommentLength {
+		return "", fmt.Errorf("comment is longer than %d characters", maxCommentLength)
+	}
+	return body, nil
+}
@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"gorm.io/gorm"
+	"os"
+	"testing"
+	"twilu/internal/database"
+)
+
+// testDB connects to the Postgres database named by TWILU_TEST_DB_URL and
+// runs the test inside a transaction that is rolled back afterwards. Tests
+// that need it are skipped when the variable is not set.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dbURL := os.Getenv("TWILU_TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("TWILU_TEST_DB_URL is not set")
+	}
+	t.Setenv("DB_URL", dbURL)
+	db, err := database.New()
+	if err != nil {
+		t.Fatalf("unable to connect to the test database: %v", err)
+	}
+	tx := db.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
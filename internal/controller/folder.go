@@ -1,8 +1,13 @@
 package controller
 
 import (
+	"encoding/base64"
 	"fmt"
 	"gorm.io/gorm"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 	"twilu/internal/model"
 )
 
@@ -16,14 +21,32 @@ func NewFolderController(db *gorm.DB) *FolderController {
 	return &FolderController{DB: db}
 }
 
-func (fc *FolderController) CreateFolder(folder model.Folder, userID int) error {
-	return fc.DB.Transaction(func(tx *gorm.DB) error {
+func (fc *FolderController) CreateFolder(folder model.Folder, userID int) (model.Folder, error) {
+	err := fc.DB.Transaction(func(tx *gorm.DB) error {
 		var user model.User
 		if err := tx.First(&user, userID).Error; err != nil {
 			return fmt.Errorf("user not found: %w", err)
 		}
 		folder.Owner = user.ID
 		folder.OwnerUsername = user.Username
+		if folder.ParentID != nil {
+			parent, err := parentFolder(tx, *folder.ParentID, userID)
+			if err != nil {
+				return err
+			}
+			ancestors, err := folderAncestors(tx, parent)
+			if err != nil {
+				return err
+			}
+			if len(ancestors)+2 > maxFolderDepth {
+				return fmt.Errorf("folders can't be nested more than %d deep", maxFolderDepth)
+			}
+			if parent.Private {
+				folder.Private = true
+			}
+		}
+		tags := folder.Tags
+		folder.Tags = nil
 		if err := tx.Create(&folder).Error; err != nil {
 			return fmt.Errorf("failed to create folder: %w", err)
 		}
@@ -31,83 +54,486 @@ func (fc *FolderController) CreateFolder(folder model.Folder, userID int) error
 		if err != nil {
 			return err
 		}
-		return nil
+		return setFolderTags(tx, &folder, tags)
+	})
+	if err != nil {
+		return model.Folder{}, err
+	}
+	return folder, nil
+}
+
+// CloneFolder copies a folder the user can view, with its items and tags, into
+// the user's library. The copy keeps the source's privacy and credits it.
+func (fc *FolderController) CloneFolder(folderID int, userID int) (model.Folder, error) {
+	var clone model.Folder
+	err := fc.DB.Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return fmt.Errorf("user not found: %w", err)
+		}
+		var source model.Folder
+		if err := tx.Preload("Tags").
+			Preload("Items", func(db *gorm.DB) *gorm.DB {
+				return db.Order("created_at ASC")
+			}).
+			First(&source, folderID).Error; err != nil {
+			return fmt.Errorf("folder not found: %w", err)
+		}
+		ok, err := canViewFolder(tx, source, userID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("user does not have permission to do that")
+		}
+
+		clone = model.Folder{
+			Name:            source.Name,
+			Owner:           user.ID,
+			OwnerUsername:   user.Username,
+			Private:         source.Private,
+			CoverURL:        source.CoverURL,
+			ClonedFromID:    &source.ID,
+			ClonedFromOwner: source.OwnerUsername,
+		}
+		if err := tx.Create(&clone).Error; err != nil {
+			return fmt.Errorf("failed to create folder: %w", err)
+		}
+		if err := tx.Model(&user).Association("Folders").Append(&clone); err != nil {
+			return err
+		}
+		if err := setFolderTags(tx, &clone, source.Tags); err != nil {
+			return err
+		}
+		for _, item := range source.Items {
+			copied := model.Item{Name: item.Name, URL: item.URL, Notes: item.Notes, FolderID: clone.ID, OwnerID: user.ID}
+			if err := tx.Create(&copied).Error; err != nil {
+				return fmt.Errorf("unable to copy item: %w", err)
+			}
+		}
+		return recordActivity(tx, model.FolderActivity{
+			FolderID:      source.ID,
+			ActorID:       user.ID,
+			ActorUsername: user.Username,
+			Kind:          ActivityFolderCloned,
+		})
 	})
+	if err != nil {
+		return model.Folder{}, err
+	}
+	return clone, nil
 }
-func (fc *FolderController) AddContributer(folderID int, userID int, newUserID int) error {
-	return fc.DB.Transaction(func(tx *gorm.DB) error {
+func (fc *FolderController) AddContributor(folderID int, userID int, username string) (model.User, error) {
+	var newUser model.User
+	err := fc.DB.Transaction(func(tx *gorm.DB) error {
 		var folder model.Folder
-		var newUser model.User
-		folderIDUint := uint(folderID)
 		if err := tx.First(&folder, folderID).Error; err != nil {
 			return fmt.Errorf("folder not found: %w", err)
 		}
-		if err := tx.First(&newUser, newUserID).Error; err != nil {
+		if folder.Owner != uint(userID) {
+			return fmt.Errorf("user does not have permission to do that")
+		}
+		if err := tx.Where("username = ?", NormalizeIdentifier(username)).First(&newUser).Error; err != nil {
 			return fmt.Errorf("new user not found: %w", err)
 		}
-		if folder.Owner != folderIDUint {
-			return fmt.Errorf("user does not have permission to do that")
+		if newUser.ID == folder.Owner {
+			return fmt.Errorf("the owner can't be a contributor")
 		}
 		if err := tx.Model(&folder).Association("Contributors").Append(&newUser); err != nil {
 			return fmt.Errorf("failed to add contributor: %w", err)
 		}
+		return notify(tx, model.Notification{
+			UserID:        newUser.ID,
+			Kind:          NotifyContributorAdded,
+			ActorUsername: folder.OwnerUsername,
+			FolderID:      &folder.ID,
+			Subject:       folder.Name,
+		})
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+	return newUser, nil
+}
+func (fc *FolderController) RemoveContributor(folderID int, userID int, contributorID int) (model.User, error) {
+	var contributor model.User
+	err := fc.DB.Transaction(func(tx *gorm.DB) error {
+		var folder model.Folder
+		if err := tx.First(&folder, folderID).Error; err != nil {
+			return fmt.Errorf("folder not found: %w", err)
+		}
+		if folder.Owner != uint(userID) {
+			return fmt.Errorf("user does not have permission to do that")
+		}
+		if err := tx.First(&contributor, contributorID).Error; err != nil {
+			return fmt.Errorf("contributor not found: %w", err)
+		}
+		if err := tx.Model(&folder).Association("Contributors").Delete(&contributor); err != nil {
+			return fmt.Errorf("failed to remove contributor: %w", err)
+		}
 		return nil
 	})
+	if err != nil {
+		return model.User{}, err
+	}
+	return contributor, nil
 }
-func (fc *FolderController) GetFolder(folderID int) (model.Folder, error) {
+
+// GetFolder returns the folder with its contributors, tags and items. Private
+// folders the user can't view are reported as not found.
+func (fc *FolderController) GetFolder(folderID int, userID int) (model.Folder, error) {
 	var folder model.Folder
 	if err := fc.DB.Model(&folder).
 		Preload("Contributors").
+		Preload("Tags").
 		Preload("Items", func(db *gorm.DB) *gorm.DB {
 			return db.Order("created_at DESC")
 		}).
-		Find(&folder, folderID).Error; err != nil {
+		First(&folder, folderID).Error; err != nil {
+		return model.Folder{}, fmt.Errorf("folder not found: %w", err)
+	}
+	ok, err := canViewFolder(fc.DB, folder, userID)
+	if err != nil {
 		return model.Folder{}, err
 	}
+	if !ok {
+		return model.Folder{}, fmt.Errorf("folder not found: %w", gorm.ErrRecordNotFound)
+	}
 	return folder, nil
 }
-func (fc *FolderController) DeleteFolder(folderID int, userID int) error {
-	return fc.DB.Transaction(func(tx *gorm.DB) error {
-		var user model.User
-		var folder model.Folder
 
+// UpdateFolder changes the folder's name, privacy, cover and tags, recording
+// renames and privacy changes in its activity feed.
+func (fc *FolderController) UpdateFolder(folderID int, userID int, changes model.Folder) (model.Folder, error) {
+	var folder model.Folder
+	changes.Name = strings.TrimSpace(changes.Name)
+	if changes.Name == "" {
+		return model.Folder{}, fmt.Errorf("folder name must not be blank")
+	}
+	err := fc.DB.Transaction(func(tx *gorm.DB) error {
+		var user model.User
 		if err := tx.First(&user, userID).Error; err != nil {
 			return fmt.Errorf("user not found: %w", err)
 		}
 		if err := tx.First(&folder, folderID).Error; err != nil {
 			return fmt.Errorf("folder not found: %w", err)
 		}
-		// Check if the user is the owner of the folder
-		if userID != int(folder.Owner) {
+		if folder.Owner != user.ID {
 			return fmt.Errorf("user is not the owner")
 		}
+		if folder.ParentID != nil && !changes.Private {
+			var parent model.Folder
+			if err := tx.First(&parent, *folder.ParentID).Error; err != nil {
+				return fmt.Errorf("parent folder not found: %w", err)
+			}
+			if parent.Private {
+				return fmt.Errorf("a folder inside a private folder must be private")
+			}
+		}
+		previous := folder
+		folder.Name = changes.Name
+		folder.Private = changes.Private
+		folder.CoverURL = changes.CoverURL
+		if err := tx.Model(&folder).Select("Name", "Private", "CoverURL").Updates(&folder).Error; err != nil {
+			return fmt.Errorf("unable to update folder: %w", err)
+		}
+		if err := setFolderTags(tx, &folder, changes.Tags); err != nil {
+			return err
+		}
 
-		if err := tx.Model(&folder).Association("Contributors").Clear(); err != nil {
-			return fmt.Errorf("unable to clear folder contributors: %w", err)
+		activity := model.FolderActivity{FolderID: folder.ID, ActorID: user.ID, ActorUsername: user.Username}
+		if previous.Name != folder.Name {
+			activity.Kind = ActivityFolderRenamed
+			activity.Subject = folder.Name
+			activity.Detail = previous.Name
+			if err := recordActivity(tx, activity); err != nil {
+				return err
+			}
 		}
+		if folder.Private && !previous.Private {
+			// Subfolders follow their parent into privacy.
+			if err := makeSubtreePrivate(tx, &folder); err != nil {
+				return err
+			}
+		}
+		if previous.Private != folder.Private {
+			activity.Kind = ActivityPrivacyChanged
+			activity.Subject = "public"
+			if folder.Private {
+				activity.Subject = "private"
+			}
+			activity.Detail = ""
+			if err := recordActivity(tx, activity); err != nil {
+				return err
+			}
+		}
+		return enqueueWebhooks(tx, folder.ID, WebhookFolderUpdated, &folder, nil)
+	})
+	if err != nil {
+		return model.Folder{}, err
+	}
+	return folder, nil
+}
 
-		if err := tx.Model(&user).Association("Folders").Delete(&folder); err != nil {
-			return fmt.Errorf("unable to remove folder from user's folders: %w", err)
+// CanViewFolder reports whether the user may see the folder.
+func (fc *FolderController) CanViewFolder(folderID int, userID int) (bool, error) {
+	var folder model.Folder
+	if err := fc.DB.First(&folder, folderID).Error; err != nil {
+		return false, fmt.Errorf("folder not found: %w", err)
+	}
+	return canViewFolder(fc.DB, folder, userID)
+}
+
+// GetActivity returns the most recent activity of a folder the user can view.
+func (fc *FolderController) GetActivity(folderID int, userID int) ([]model.FolderActivity, error) {
+	var folder model.Folder
+	if err := fc.DB.First(&folder, folderID).Error; err != nil {
+		return []model.FolderActivity{}, fmt.Errorf("folder not found: %w", err)
+	}
+	ok, err := canViewFolder(fc.DB, folder, userID)
+	if err != nil {
+		return []model.FolderActivity{}, err
+	}
+	if !ok {
+		return []model.FolderActivity{}, fmt.Errorf("user does not have permission to do that")
+	}
+	var activity []model.FolderActivity
+	if err := fc.DB.Where("folder_id = ?", folderID).
+		Order("created_at DESC").
+		Limit(activityPageSize).
+		Find(&activity).Error; err != nil {
+		return []model.FolderActivity{}, err
+	}
+	return activity, nil
+}
+
+// DeleteFolder moves the folder and its subfolders to the owner's trash.
+func (fc *FolderController) DeleteFolder(folderID int, userID int) (model.Folder, error) {
+	var folder model.Folder
+	err := fc.DB.Transaction(func(tx *gorm.DB) error {
+		var user model.User
+
+		if err := tx.First(&user, userID).Error; err != nil {
+			return fmt.Errorf("user not found: %w", err)
+		}
+		if err := tx.First(&folder, folderID).Error; err != nil {
+			return fmt.Errorf("folder not found: %w", err)
+		}
+		// Check if the user is the owner of the folder
+		if userID != int(folder.Owner) {
+			return fmt.Errorf("user is not the owner")
 		}
-		if err := tx.Where("Folder_ID = ?", folderID).Unscoped().Delete(&model.Item{}).Error; err != nil {
-			return fmt.Errorf("unable to delete items: %w", err)
+		if folder.Inbox {
+			return fmt.Errorf("the inbox can't be deleted")
 		}
 
-		if err := tx.Unscoped().Delete(&folder).Error; err != nil {
+		// The folder goes to the trash with its items and contributors intact,
+		// so it can be restored until the trash is purged. Its subfolders go
+		// with it, stamped with the same time so they are restored together.
+		descendants, err := folderDescendants(tx, folder.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("id IN ?", append(descendants, folder.ID)).Delete(&model.Folder{}).Error; err != nil {
 			return fmt.Errorf("unable to delete folder: %w", err)
 		}
 		return nil
 	})
+	if err != nil {
+		return model.Folder{}, err
+	}
+	return folder, nil
+}
+
+// Sort modes of the public feed.
+const (
+	FeedSortNewest    = "newest"
+	FeedSortMostLiked = "most-liked"
+	FeedSortMostSaved = "most-saved"
+)
+
+// feedPageSize is how many folders one page of the public feed holds.
+const feedPageSize = 20
+
+// FeedQuery filters and orders the public feed. Cursor is the cursor returned
+// with the previous page, or empty for the first page.
+type FeedQuery struct {
+	Owner  string
+	Tag    string
+	From   time.Time
+	To     time.Time
+	Sort   string
+	Cursor string
 }
-func (fc *FolderController) GetFeed() ([]model.Folder, error) {
+
+// GetFeed returns a page of public folders matching the query, along with the
+// cursor of the next page, which is empty on the last page. Folders of
+// accounts scheduled for deletion are left out, as on profiles.
+func (fc *FolderController) GetFeed(query FeedQuery) ([]model.Folder, string, error) {
+	active := fc.DB.Model(&model.User{}).Select("id").Where("deletion_requested_at IS NULL")
+	db := fc.DB.Model(&model.Folder{}).Preload("Tags").Where("private = ? AND owner IN (?)", false, active)
+	if query.Owner != "" {
+		db = db.Where("owner_username = ?", NormalizeIdentifier(strings.TrimPrefix(query.Owner, "@")))
+	}
+	if query.Tag != "" {
+		tagged := fc.DB.Table("folder_tags").
+			Select("folder_tags.folder_id").
+			Joins("JOIN tags ON tags.id = folder_tags.tag_id").
+			Where("tags.name = ?", NormalizeTag(query.Tag))
+		db = db.Where("id IN (?)", tagged)
+	}
+	if !query.From.IsZero() {
+		db = db.Where("created_at >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		db = db.Where("created_at < ?", query.To)
+	}
+
+	// Folders are paged by keyset on (count, id) so that new folders or likes
+	// don't shift later pages. Ids grow with creation time, so the newest sort
+	// only needs the id.
+	column := ""
+	switch query.Sort {
+	case "", FeedSortNewest:
+	case FeedSortMostLiked:
+		column = "like_count"
+	case FeedSortMostSaved:
+		column = "save_count"
+	default:
+		return []model.Folder{}, "", fmt.Errorf("unknown sort %q", query.Sort)
+	}
+	if query.Cursor != "" {
+		count, id, err := decodeFeedCursor(query.Cursor)
+		if err != nil {
+			return []model.Folder{}, "", err
+		}
+		if column == "" {
+			db = db.Where("id < ?", id)
+		} else {
+			db = db.Where("("+column+" < ? OR ("+column+" = ? AND id < ?))", count, count, id)
+		}
+	}
+	if column != "" {
+		db = db.Order(column + " DESC")
+	}
+
 	var folders []model.Folder
-	if err := fc.DB.Model(&model.Folder{}).
-		Where("Private = ?", false).
+	if err := db.Order("id DESC").Limit(feedPageSize + 1).Find(&folders).Error; err != nil {
+		return []model.Folder{}, "", err
+	}
+	next := ""
+	if len(folders) > feedPageSize {
+		folders = folders[:feedPageSize]
+		last := folders[len(folders)-1]
+		count := 0
+		switch column {
+		case "like_count":
+			count = last.LikeCount
+		case "save_count":
+			count = last.SaveCount
+		}
+		next = encodeFeedCursor(count, last.ID)
+	}
+	return folders, next, nil
+}
+
+// encodeFeedCursor packs the sort value and id of the last folder of a page.
+func encodeFeedCursor(count int, id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", count, id)))
+}
+func decodeFeedCursor(cursor string) (int, uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cursor: %w", err)
+	}
+	countStr, idStr, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid cursor")
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cursor: %w", err)
+	}
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cursor: %w", err)
+	}
+	return count, uint(id), nil
+}
+
+// FeedEntry is one line of the following feed: either a newly created public
+// folder or an item added to a public folder.
+type FeedEntry struct {
+	At     time.Time
+	Actor  string
+	Folder model.Folder
+	Item   *model.Item
+}
+
+// followingFeedSize caps how many entries the following feed returns.
+const followingFeedSize = 50
+
+// GetFollowingFeed returns new public folders and item additions from the
+// users that userID follows, newest first.
+func (fc *FolderController) GetFollowingFeed(userID int) ([]FeedEntry, error) {
+	followed := fc.DB.Model(&model.Follow{}).Select("followee_id").Where("follower_id = ?", userID)
+
+	var folders []model.Folder
+	if err := fc.DB.Where("owner IN (?) AND private = ?", followed, false).
 		Order("created_at DESC").
-		Limit(20).
+		Limit(followingFeedSize).
 		Find(&folders).Error; err != nil {
-		fmt.Println(folders)
-		return []model.Folder{}, err
+		return []FeedEntry{}, err
+	}
+	var items []model.Item
+	if err := fc.DB.Joins("JOIN folders ON folders.id = items.folder_id AND folders.deleted_at IS NULL").
+		Where("items.owner_id IN (?) AND folders.private = ?", followed, false).
+		Order("items.created_at DESC").
+		Limit(followingFeedSize).
+		Find(&items).Error; err != nil {
+		return []FeedEntry{}, err
+	}
+
+	entries := make([]FeedEntry, 0, len(folders)+len(items))
+	for _, folder := range folders {
+		entries = append(entries, FeedEntry{At: folder.CreatedAt, Actor: folder.OwnerUsername, Folder: folder})
+	}
+	if len(items) > 0 {
+		folderIDs := make([]uint, 0, len(items))
+		ownerIDs := make([]uint, 0, len(items))
+		for _, item := range items {
+			folderIDs = append(folderIDs, item.FolderID)
+			ownerIDs = append(ownerIDs, item.OwnerID)
+		}
+		var itemFolders []model.Folder
+		if err := fc.DB.Find(&itemFolders, folderIDs).Error; err != nil {
+			return []FeedEntry{}, err
+		}
+		var owners []model.User
+		if err := fc.DB.Select("id", "username").Find(&owners, ownerIDs).Error; err != nil {
+			return []FeedEntry{}, err
+		}
+		foldersByID := make(map[uint]model.Folder, len(itemFolders))
+		for _, folder := range itemFolders {
+			foldersByID[folder.ID] = folder
+		}
+		usernames := make(map[uint]string, len(owners))
+		for _, owner := range owners {
+			usernames[owner.ID] = owner.Username
+		}
+		for i := range items {
+			entries = append(entries, FeedEntry{
+				At:     items[i].CreatedAt,
+				Actor:  usernames[items[i].OwnerID],
+				Folder: foldersByID[items[i].FolderID],
+				Item:   &items[i],
+			})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].At.After(entries[j].At) })
+	if len(entries) > followingFeedSize {
+		entries = entries[:followingFeedSize]
 	}
-	return folders, nil
+	return entries, nil
 }
@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"twilu/internal/model"
+)
+
+// InboxName is the name every account's inbox starts with.
+const InboxName = "Inbox"
+
+// createInbox gives a new account its private inbox folder, which is where
+// links saved without picking a folder go.
+func createInbox(tx *gorm.DB, user *model.User) (model.Folder, error) {
+	inbox := model.Folder{
+		Name:          InboxName,
+		Owner:         user.ID,
+		OwnerUsername: user.Username,
+		Private:       true,
+		Inbox:         true,
+	}
+	if err := tx.Create(&inbox).Error; err != nil {
+		return model.Folder{}, fmt.Errorf("failed to create inbox: %w", err)
+	}
+	if err := tx.Model(user).Association("Folders").Append(&inbox); err != nil {
+		return model.Folder{}, err
+	}
+	return inbox, nil
+}
+
+// inboxOf returns the user's inbox, creating it for accounts made before
+// every account had one. If another request creates it first, the unique
+// index on inboxes refuses the second one and the winner's is returned.
+func inboxOf(tx *gorm.DB, userID int) (model.Folder, error) {
+	var inbox model.Folder
+	err := tx.Where("owner = ? AND inbox = ?", userID, true).First(&inbox).Error
+	if err == nil {
+		return inbox, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.Folder{}, err
+	}
+	var user model.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		return model.Folder{}, fmt.Errorf("user not found: %w", err)
+	}
+	var created model.Folder
+	err = tx.Transaction(func(tx *gorm.DB) error {
+		created, err = createInbox(tx, &user)
+		return err
+	})
+	if err == nil {
+		return created, nil
+	}
+	if tx.Where("owner = ? AND inbox = ?", userID, true).First(&inbox).Error == nil {
+		return inbox, nil
+	}
+	return model.Folder{}, err
+}
+
+// GetInbox returns the user's inbox with its items, newest first.
+func (ic *ItemController) GetInbox(userID int) (model.Folder, error) {
+	inbox, err := inboxOf(ic.DB, userID)
+	if err != nil {
+		return model.Folder{}, err
+	}
+	if err := ic.DB.Where("folder_id = ?", inbox.ID).Order("created_at DESC").Find(&inbox.Items).Error; err != nil {
+		return model.Folder{}, err
+	}
+	return inbox, nil
+}
+
+// SaveToInbox adds a link to the user's inbox. A blank title falls back to
+// the URL.
+func (ic *ItemController) SaveToInbox(userID int, rawURL string, title string) (model.Item, model.Folder, error) {
+	inbox, err := inboxOf(ic.DB, userID)
+	if err != nil {
+		return model.Item{}, model.Folder{}, err
+	}
+	return ic.QuickSave(userID, int(inbox.ID), rawURL, title, false)
+}
+
+// MoveItem moves an item to another folder. The user must be allowed to
+// remove the item from its folder, as in DeleteItem, and to add items to the
+// target folder. Comments on the item move with it.
+func (ic *ItemController) MoveItem(folderID int, itemID int, targetID int, userID int) (model.Item, error) {
+	if folderID == targetID {
+		return model.Item{}, fmt.Errorf("item is already in that folder")
+	}
+	var item, removed model.Item
+	var user model.User
+	var source, target model.Folder
+	err := ic.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, userID).Error; err != nil {
+			return fmt.Errorf("user not found: %w", err)
+		}
+		if err := tx.First(&source, folderID).Error; err != nil {
+			return fmt.Errorf("folder not found: %w", err)
+		}
+		if err := tx.First(&target, targetID).Error; err != nil {
+			return fmt.Errorf("folder not found: %w", err)
+		}
+		if err := tx.Where("folder_id = ?", source.ID).First(&item, itemID).Error; err != nil {
+			return fmt.Errorf("item not found: %w", err)
+		}
+		if userID != int(item.OwnerID) && userID != int(source.Owner) {
+			return fmt.Errorf("user is not the owner")
+		}
+		if target.Owner != uint(userID) {
+			contributor, err := isContributor(tx, target.ID, userID)
+			if err != nil {
+				return err
+			}
+			if !contributor {
+				return fmt.Errorf("user does not have permission to do that")
+			}
+		}
+		if err := tx.Model(&item).Update("folder_id", target.ID).Error; err != nil {
+			return fmt.Errorf("unable to move item: %w", err)
+		}
+		if err := tx.Model(&model.Comment{}).Where("item_id = ?", item.ID).Update("folder_id", target.ID).Error; err != nil {
+			return fmt.Errorf("unable to move comments: %w", err)
+		}
+		for _, activity := range []model.FolderActivity{
+			{FolderID: source.ID, Detail: "to " + target.Name},
+			{FolderID: target.ID, Detail: "from " + source.Name},
+		} {
+			activity.ActorID = user.ID
+			activity.ActorUsername = user.Username
+			activity.Kind = ActivityItemMoved
+			activity.ItemID = &item.ID
+			activity.Subject = item.Name
+			if err := recordActivity(tx, activity); err != nil {
+				return err
+			}
+		}
+		// The source folder's hooks are told about the item as it was there.
+		removed = item
+		removed.FolderID = source.ID
+		if err := enqueueWebhooks(tx, source.ID, WebhookItemDeleted, nil, &removed); err != nil {
+			return err
+		}
+		return enqueueWebhooks(tx, target.ID, WebhookItemCreated, nil, &item)
+	})
+	if err != nil {
+		return model.Item{}, err
+	}
+	ic.publish(ActivityItemRemoved, removed, user)
+	ic.publish(ActivityItemAdded, item, user)
+	return item, nil
+}
@@ -3,61 +3,170 @@ package controller
 import (
 	"fmt"
 	"gorm.io/gorm"
+	"strings"
 	"twilu/internal/model"
+	"twilu/internal/realtime"
+	"unicode/utf8"
 )
 
 // ItemController handles operations on folders.
 type ItemController struct {
 	DB *gorm.DB
+	// Events tells the pages that have a folder open about changes to its
+	// items once they are committed.
+	Events realtime.FanOut
 }
 
 // NewItemController creates a new instance of ItemController.
-func NewItemController(db *gorm.DB) *ItemController {
-	return &ItemController{DB: db}
+func NewItemController(db *gorm.DB, events realtime.FanOut) *ItemController {
+	return &ItemController{DB: db, Events: events}
 }
 
-func (ic *ItemController) AddItemToFolder(folderID int, item model.Item, userID int) error {
-	return ic.DB.Transaction(func(tx *gorm.DB) error {
+func (ic *ItemController) AddItemToFolder(folderID int, item model.Item, userID int) (model.Item, error) {
+	item.Notes = strings.TrimSpace(strings.ReplaceAll(item.Notes, "\r\n", "\n"))
+	if utf8.RuneCountInString(item.Notes) > maxNotesLength {
+		return model.Item{}, fmt.Errorf("notes must be at most %d characters", maxNotesLength)
+	}
+	var user model.User
+	err := ic.DB.Transaction(func(tx *gorm.DB) error {
 		var folder model.Folder
 		userIDUint := uint(userID)
 		if err := tx.First(&folder, folderID).Error; err != nil {
 			return fmt.Errorf("folder not found: %w", err)
 		}
-		var user model.User
 		if err := tx.First(&user, userID).Error; err != nil {
 			return fmt.Errorf("user not found: %w", err)
 		}
 		if folder.Owner != userIDUint {
-			return fmt.Errorf("user does not have permission to do that")
+			contributor, err := isContributor(tx, folder.ID, userID)
+			if err != nil {
+				return err
+			}
+			if !contributor {
+				return fmt.Errorf("user does not have permission to do that")
+			}
 		}
 		item.OwnerID = userIDUint
 		item.FolderID = folder.ID
 		if err := tx.Create(&item).Error; err != nil {
 			return fmt.Errorf("failed to create picture: %w", err)
 		}
-		return nil
+		if err := recordActivity(tx, model.FolderActivity{
+			FolderID:      folder.ID,
+			ActorID:       user.ID,
+			ActorUsername: user.Username,
+			Kind:          ActivityItemAdded,
+			ItemID:        &item.ID,
+			Subject:       item.Name,
+		}); err != nil {
+			return err
+		}
+		return enqueueWebhooks(tx, folder.ID, WebhookItemCreated, nil, &item)
 	})
+	if err != nil {
+		return model.Item{}, err
+	}
+	ic.publish(ActivityItemAdded, item, user)
+	return item, nil
 }
-func (ic *ItemController) DeleteItem(folderID int, userID int, itemID int) error {
-	return ic.DB.Transaction(func(tx *gorm.DB) error {
-		var user model.User
+
+// DeleteItem moves the item to its owner's trash.
+func (ic *ItemController) DeleteItem(folderID int, userID int, itemID int) (model.Item, error) {
+	var item model.Item
+	var user model.User
+	err := ic.DB.Transaction(func(tx *gorm.DB) error {
 		var folder model.Folder
-		var item model.Item
 		if err := tx.First(&user, userID).Error; err != nil {
 			return fmt.Errorf("user not found: %w", err)
 		}
 		if err := tx.First(&folder, folderID).Error; err != nil {
 			return fmt.Errorf("folder not found: %w", err)
 		}
-		if err := tx.First(&item, itemID).Error; err != nil {
+		if err := tx.Where("folder_id = ?", folder.ID).First(&item, itemID).Error; err != nil {
 			return fmt.Errorf("item not found: %w", err)
 		}
-		if userID != int(item.OwnerID) {
+		// Folder owners may remove anything added to their folder.
+		if userID != int(item.OwnerID) && userID != int(folder.Owner) {
 			return fmt.Errorf("user is not the owner")
 		}
-		if err := tx.Unscoped().Delete(&item).Error; err != nil {
+		if err := tx.Delete(&item).Error; err != nil {
 			return fmt.Errorf("unable to delete item: %w", err)
 		}
-		return nil
+		if err := recordActivity(tx, model.FolderActivity{
+			FolderID:      folder.ID,
+			ActorID:       user.ID,
+			ActorUsername: user.Username,
+			Kind:          ActivityItemRemoved,
+			ItemID:        &item.ID,
+			Subject:       item.Name,
+		}); err != nil {
+			return err
+		}
+		return enqueueWebhooks(tx, folder.ID, WebhookItemDeleted, nil, &item)
+	})
+	if err != nil {
+		return model.Item{}, err
+	}
+	ic.publish(ActivityItemRemoved, item, user)
+	return item, nil
+}
+func (ic *ItemController) RenameItem(folderID int, userID int, itemID int, name string) (model.Item, error) {
+	var item model.Item
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return model.Item{}, fmt.Errorf("item name must not be blank")
+	}
+	var user model.User
+	renamed := false
+	err := ic.DB.Transaction(func(tx *gorm.DB) error {
+		var folder model.Folder
+		if err := tx.First(&user, userID).Error; err != nil {
+			return fmt.Errorf("user not found: %w", err)
+		}
+		if err := tx.First(&folder, folderID).Error; err != nil {
+			return fmt.Errorf("folder not found: %w", err)
+		}
+		if err := tx.Where("folder_id = ?", folder.ID).First(&item, itemID).Error; err != nil {
+			return fmt.Errorf("item not found: %w", err)
+		}
+		if userID != int(item.OwnerID) && userID != int(folder.Owner) {
+			return fmt.Errorf("user is not the owner")
+		}
+		if item.Name == name {
+			return nil
+		}
+		previous := item.Name
+		if err := tx.Model(&item).Update("name", name).Error; err != nil {
+			return fmt.Errorf("unable to rename item: %w", err)
+		}
+		renamed = true
+		return recordActivity(tx, model.FolderActivity{
+			FolderID:      folder.ID,
+			ActorID:       user.ID,
+			ActorUsername: user.Username,
+			Kind:          ActivityItemRenamed,
+			ItemID:        &item.ID,
+			Subject:       name,
+			Detail:        previous,
+		})
+	})
+	if err != nil {
+		return model.Item{}, err
+	}
+	if renamed {
+		ic.publish(ActivityItemRenamed, item, user)
+	}
+	return item, nil
+}
+
+// publish tells the pages that have the item's folder open about a change
+// to the item.
+func (ic *ItemController) publish(kind string, item model.Item, actor model.User) {
+	ic.Events.Publish(realtime.Event{
+		FolderID:      item.FolderID,
+		Kind:          kind,
+		ItemID:        item.ID,
+		Name:          item.Name,
+		ActorUsername: actor.Username,
 	})
 }
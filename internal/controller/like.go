@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"twilu/internal/model"
+)
+
+func (fc *FolderController) LikeFolder(folderID int, userID int) (model.Folder, error) {
+	return fc.react(folderID, func(tx *gorm.DB, folder model.Folder) (bool, error) {
+		like := model.FolderLike{FolderID: folder.ID, UserID: uint(userID)}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&like)
+		if result.Error != nil || result.RowsAffected == 0 || folder.Owner == uint(userID) {
+			return result.RowsAffected > 0, result.Error
+		}
+		var user model.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return false, fmt.Errorf("user not found: %w", err)
+		}
+		return true, notify(tx, model.Notification{
+			UserID:        folder.Owner,
+			Kind:          NotifyFolderLiked,
+			ActorUsername: user.Username,
+			FolderID:      &folder.ID,
+			Subject:       folder.Name,
+		})
+	}, "like_count", 1)
+}
+func (fc *FolderController) UnlikeFolder(folderID int, userID int) (model.Folder, error) {
+	return fc.react(folderID, func(tx *gorm.DB, folder model.Folder) (bool, error) {
+		result := tx.Where("folder_id = ? AND user_id = ?", folder.ID, userID).Delete(&model.FolderLike{})
+		return result.RowsAffected > 0, result.Error
+	}, "like_count", -1)
+}
+
+// SaveFolder adds someone else's public folder to the user's saved folders.
+func (fc *FolderController) SaveFolder(folderID int, userID int) (model.Folder, error) {
+	return fc.react(folderID, func(tx *gorm.DB, folder model.Folder) (bool, error) {
+		if folder.Owner == uint(userID) {
+			return false, fmt.Errorf("users can't save their own folders")
+		}
+		saved := model.SavedFolder{FolderID: folder.ID, UserID: uint(userID)}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&saved)
+		return result.RowsAffected > 0, result.Error
+	}, "save_count", 1)
+}
+func (fc *FolderController) UnsaveFolder(folderID int, userID int) (model.Folder, error) {
+	return fc.react(folderID, func(tx *gorm.DB, folder model.Folder) (bool, error) {
+		result := tx.Where("folder_id = ? AND user_id = ?", folder.ID, userID).Delete(&model.SavedFolder{})
+		return result.RowsAffected > 0, result.Error
+	}, "save_count", -1)
+}
+
+// react applies a like or save change to a public folder and, if it changed
+// anything, moves the folder's counter in column by delta.
+func (fc *FolderController) react(folderID int, change func(tx *gorm.DB, folder model.Folder) (bool, error), column string, delta int) (model.Folder, error) {
+	var folder model.Folder
+	err := fc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&folder, folderID).Error; err != nil {
+			return fmt.Errorf("folder not found: %w", err)
+		}
+		// Taking back a like or save is allowed after a folder turns private.
+		if folder.Private && delta > 0 {
+			return fmt.Errorf("only public folders can be liked or saved")
+		}
+		changed, err := change(tx, folder)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return nil
+		}
+		if err := tx.Model(&folder).UpdateColumn(column, gorm.Expr(column+" + ?", delta)).Error; err != nil {
+			return fmt.Errorf("unable to update %s: %w", column, err)
+		}
+		return tx.First(&folder, folder.ID).Error
+	})
+	if err != nil {
+		return model.Folder{}, err
+	}
+	return folder, nil
+}
+
+// GetReactions returns which of the folders the user has liked and saved.
+func (fc *FolderController) GetReactions(userID int, folderIDs []uint) (liked map[uint]bool, saved map[uint]bool, err error) {
+	liked = make(map[uint]bool)
+	saved = make(map[uint]bool)
+	if len(folderIDs) == 0 {
+		return liked, saved, nil
+	}
+	var likes []model.FolderLike
+	if err := fc.DB.Where("user_id = ? AND folder_id IN ?", userID, folderIDs).Find(&likes).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, like := range likes {
+		liked[like.FolderID] = true
+	}
+	var saves []model.SavedFolder
+	if err := fc.DB.Where("user_id = ? AND folder_id IN ?", userID, folderIDs).Find(&saves).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, save := range saves {
+		saved[save.FolderID] = true
+	}
+	return liked, saved, nil
+}
+
+// GetSavedFolders returns the folders the user saved that are still public,
+// most recently saved first.
+func (fc *FolderController) GetSavedFolders(userID int) ([]model.Folder, error) {
+	var folders []model.Folder
+	if err := fc.DB.Joins("JOIN saved_folders ON saved_folders.folder_id = folders.id").
+		Where("saved_folders.user_id = ? AND folders.private = ?", userID, false).
+		Order("saved_folders.created_at DESC").
+		Find(&folders).Error; err != nil {
+		return []model.Folder{}, err
+	}
+	return folders, nil
+}
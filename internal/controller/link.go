@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+	"twilu/internal/model"
+	"twilu/internal/netguard"
+)
+
+const (
+	// linkRecheckAfter is how long the result of a link check is trusted.
+	linkRecheckAfter = 24 * time.Hour
+	// linkCheckBatch caps how many links one run of the checker visits.
+	linkCheckBatch = 100
+)
+
+// LinkController checks that the links saved in items still work.
+type LinkController struct {
+	DB     *gorm.DB
+	Client *http.Client
+}
+
+// NewLinkController creates a new instance of LinkController. Its client
+// refuses to connect to internal addresses.
+func NewLinkController(db *gorm.DB) *LinkController {
+	return &LinkController{DB: db, Client: netguard.NewClient(10 * time.Second)}
+}
+
+// CheckLinks checks the links that were not checked recently, and notifies
+// the owners of the item and of its folder when one breaks. An item whose
+// result can't be recorded is logged and checked again on the next run.
+func (lc *LinkController) CheckLinks() error {
+	var items []model.Item
+	if err := lc.DB.Where("url <> '' AND (link_checked_at IS NULL OR link_checked_at < ?)", time.Now().Add(-linkRecheckAfter)).
+		Order("link_checked_at ASC NULLS FIRST").
+		Limit(linkCheckBatch).
+		Find(&items).Error; err != nil {
+		return err
+	}
+	for _, item := range items {
+		broken := !lc.linkWorks(item.URL)
+		err := lc.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&item).UpdateColumns(map[string]interface{}{
+				"link_broken":     broken,
+				"link_checked_at": time.Now(),
+			}).Error; err != nil {
+				return err
+			}
+			if !broken || item.LinkBroken {
+				return nil
+			}
+			var folder model.Folder
+			if err := tx.Limit(1).Find(&folder, item.FolderID).Error; err != nil || folder.ID == 0 {
+				return err
+			}
+			recipients := []uint{folder.Owner}
+			if item.OwnerID != folder.Owner {
+				recipients = append(recipients, item.OwnerID)
+			}
+			for _, recipient := range recipients {
+				if err := notify(tx, model.Notification{
+					UserID:   recipient,
+					Kind:     NotifyLinkBroken,
+					FolderID: &folder.ID,
+					ItemID:   &item.ID,
+					Subject:  item.Name,
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("unable to record link check of item %d: %v", item.ID, err)
+		}
+	}
+	return nil
+}
+
+// linkWorks reports whether the link responds. Links that aren't on the
+// public web can't be checked and are assumed to work.
+func (lc *LinkController) linkWorks(link string) bool {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return true
+	}
+	resp, err := lc.Client.Head(link)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, err = lc.Client.Get(link)
+	}
+	if errors.Is(err, netguard.ErrBlocked) {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		// The site is up but won't let the checker in.
+		return true
+	}
+	return resp.StatusCode < http.StatusBadRequest
+}
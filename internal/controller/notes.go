@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"twilu/internal/model"
+	"unicode/utf8"
+)
+
+// maxNotesLength caps the notes of an item, in characters.
+const maxNotesLength = 10000
+
+// searchLimit caps how many items a search returns.
+const searchLimit = 50
+
+// SearchResult is an item found by a search, with the name of its folder.
+type SearchResult struct {
+	model.Item `gorm:"embedded"`
+	FolderName string
+}
+
+// UpdateNotes replaces the notes of an item. Like renaming, it is open to the
+// person who added the item and to the folder's owner.
+func (ic *ItemController) UpdateNotes(folderID int, userID int, itemID int, notes string) (model.Item, error) {
+	notes = strings.TrimSpace(strings.ReplaceAll(notes, "\r\n", "\n"))
+	if utf8.RuneCountInString(notes) > maxNotesLength {
+		return model.Item{}, fmt.Errorf("notes must be at most %d characters", maxNotesLength)
+	}
+	var item model.Item
+	err := ic.DB.Transaction(func(tx *gorm.DB) error {
+		var folder model.Folder
+		if err := tx.First(&folder, folderID).Error; err != nil {
+			return fmt.Errorf("folder not found: %w", err)
+		}
+		if err := tx.Where("folder_id = ?", folder.ID).First(&item, itemID).Error; err != nil {
+			return fmt.Errorf("item not found: %w", err)
+		}
+		if userID != int(item.OwnerID) && userID != int(folder.Owner) {
+			return fmt.Errorf("user is not the owner")
+		}
+		if err := tx.Model(&item).Update("notes", notes).Error; err != nil {
+			return fmt.Errorf("unable to update notes: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return model.Item{}, err
+	}
+	return item, nil
+}
+
+// SearchItems finds the items whose name, URL or notes contain the query, in
+// the folders the user owns or contributes to.
+func (ic *ItemController) SearchItems(userID int, query string) ([]SearchResult, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return []SearchResult{}, nil
+	}
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query) + "%"
+	contributed := ic.DB.Table("folder_contributors").Select("folder_id").Where("user_id = ?", userID)
+	var results []SearchResult
+	if err := ic.DB.Model(&model.Item{}).
+		Select("items.*, folders.name AS folder_name").
+		Joins("JOIN folders ON folders.id = items.folder_id AND folders.deleted_at IS NULL").
+		Where("folders.owner = ? OR folders.id IN (?)", userID, contributed).
+		Where("items.name ILIKE ? OR items.url ILIKE ? OR items.notes ILIKE ?", pattern, pattern, pattern).
+		Order("items.updated_at DESC").
+		Limit(searchLimit).
+		Find(&results).Error; err != nil {
+		return nil, fmt.Errorf("unable to search items: %w", err)
+	}
+	return results, nil
+}
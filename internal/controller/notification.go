@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+	"twilu/internal/model"
+)
+
+// Kinds of notification.
+const (
+	NotifyContributorAdded = "contributor_added"
+	NotifyFolderLiked      = "folder_liked"
+	NotifyCommentReply     = "comment_reply"
+	NotifyLinkBroken       = "link_broken"
+)
+
+// NotificationKinds lists every kind of notification, in the order they are
+// shown on the account page.
+var NotificationKinds = []string{NotifyContributorAdded, NotifyFolderLiked, NotifyCommentReply, NotifyLinkBroken}
+
+// notificationPageSize caps how many notifications are listed at once.
+const notificationPageSize = 50
+
+// NotificationController handles a user's notifications and their preferences.
+type NotificationController struct {
+	DB *gorm.DB
+}
+
+// NewNotificationController creates a new instance of NotificationController.
+func NewNotificationController(db *gorm.DB) *NotificationController {
+	return &NotificationController{DB: db}
+}
+
+// notify sends a notification unless its recipient turned that kind off. It
+// runs inside the transaction of the change it is about.
+func notify(tx *gorm.DB, notification model.Notification) error {
+	var preference model.NotificationPreference
+	err := tx.Where("user_id = ? AND kind = ?", notification.UserID, notification.Kind).Limit(1).Find(&preference).Error
+	if err != nil {
+		return err
+	}
+	if preference.ID != 0 && !preference.Enabled {
+		return nil
+	}
+	if err := tx.Create(&notification).Error; err != nil {
+		return fmt.Errorf("unable to send notification: %w", err)
+	}
+	return nil
+}
+func (nc *NotificationController) GetNotifications(userID int) ([]model.Notification, error) {
+	var notifications []model.Notification
+	if err := nc.DB.Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(notificationPageSize).
+		Find(&notifications).Error; err != nil {
+		return []model.Notification{}, err
+	}
+	return notifications, nil
+}
+func (nc *NotificationController) UnreadCount(userID int) (int64, error) {
+	var count int64
+	if err := nc.DB.Model(&model.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+func (nc *NotificationController) MarkRead(notificationID int, userID int) error {
+	result := nc.DB.Model(&model.Notification{}).
+		Where("id = ? AND user_id = ? AND read_at IS NULL", notificationID, userID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("unable to mark notification as read: %w", result.Error)
+	}
+	return nil
+}
+func (nc *NotificationController) MarkAllRead(userID int) error {
+	if err := nc.DB.Model(&model.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("unable to mark notifications as read: %w", err)
+	}
+	return nil
+}
+
+// GetPreferences returns whether each kind of notification is enabled for
+// the user.
+func (nc *NotificationController) GetPreferences(userID int) (map[string]bool, error) {
+	var preferences []model.NotificationPreference
+	if err := nc.DB.Where("user_id = ?", userID).Find(&preferences).Error; err != nil {
+		return nil, err
+	}
+	enabled := make(map[string]bool, len(NotificationKinds))
+	for _, kind := range NotificationKinds {
+		enabled[kind] = true
+	}
+	for _, preference := range preferences {
+		enabled[preference.Kind] = preference.Enabled
+	}
+	return enabled, nil
+}
+
+// SetPreferences stores whether each kind of notification is enabled. Kinds
+// missing from enabled are turned off.
+func (nc *NotificationController) SetPreferences(userID int, enabled map[string]bool) error {
+	return nc.DB.Transaction(func(tx *gorm.DB) error {
+		for _, kind := range NotificationKinds {
+			preference := model.NotificationPreference{UserID: uint(userID), Kind: kind, Enabled: enabled[kind]}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "kind"}},
+				DoUpdates: clause.AssignmentColumns([]string{"enabled"}),
+			}).Create(&preference).Error; err != nil {
+				return fmt.Errorf("unable to save preferences: %w", err)
+			}
+		}
+		return nil
+	})
+}
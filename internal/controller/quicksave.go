@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"twilu/internal/model"
+)
+
+// GetQuickSaveFolders returns the folders the user can save to, which are the
+// ones they own or contribute to, along with their default folder, if any.
+func (ic *ItemController) GetQuickSaveFolders(userID int) ([]model.Folder, *uint, error) {
+	var user model.User
+	if err := ic.DB.First(&user, userID).Error; err != nil {
+		return []model.Folder{}, nil, fmt.Errorf("user not found: %w", err)
+	}
+	contributed := ic.DB.Table("folder_contributors").Select("folder_id").Where("user_id = ?", userID)
+	var folders []model.Folder
+	if err := ic.DB.Where("owner = ? OR id IN (?)", userID, contributed).
+		Order("name ASC").
+		Find(&folders).Error; err != nil {
+		return []model.Folder{}, nil, err
+	}
+	return folders, user.DefaultFolderID, nil
+}
+
+// QuickSave adds a page to a folder in one step. A folderID of 0 saves to the
+// user's default folder, or their inbox if they have none; remember makes the
+// folder saved to the new default.
+// A blank title falls back to the URL.
+func (ic *ItemController) QuickSave(userID int, folderID int, rawURL string, title string, remember bool) (model.Item, model.Folder, error) {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return model.Item{}, model.Folder{}, fmt.Errorf("only http and https pages can be saved")
+	}
+	if folderID == 0 {
+		var user model.User
+		if err := ic.DB.First(&user, userID).Error; err != nil {
+			return model.Item{}, model.Folder{}, fmt.Errorf("user not found: %w", err)
+		}
+		if user.DefaultFolderID != nil {
+			folderID = int(*user.DefaultFolderID)
+		} else {
+			inbox, err := inboxOf(ic.DB, userID)
+			if err != nil {
+				return model.Item{}, model.Folder{}, err
+			}
+			folderID = int(inbox.ID)
+		}
+	}
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = parsed.String()
+	}
+	item, err := ic.AddItemToFolder(folderID, model.Item{Name: title, URL: parsed.String()}, userID)
+	if err != nil {
+		return model.Item{}, model.Folder{}, err
+	}
+	var folder model.Folder
+	if err := ic.DB.First(&folder, item.FolderID).Error; err != nil {
+		return model.Item{}, model.Folder{}, fmt.Errorf("folder not found: %w", err)
+	}
+	if remember {
+		if err := ic.DB.Model(&model.User{}).Where("id = ?", userID).Update("default_folder_id", folder.ID).Error; err != nil {
+			return model.Item{}, model.Folder{}, fmt.Errorf("unable to set default folder: %w", err)
+		}
+	}
+	return item, folder, nil
+}
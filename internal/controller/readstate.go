@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+	"twilu/internal/model"
+)
+
+// Reading states of an item, stored in model.ItemState.
+const (
+	ItemUnread   = "unread"
+	ItemReading  = "reading"
+	ItemRead     = "read"
+	ItemArchived = "archived"
+)
+
+// ItemStates lists the reading states in the order they are offered.
+var ItemStates = []string{ItemUnread, ItemReading, ItemRead, ItemArchived}
+
+// SetItemState records how far the user has got with an item in a folder they
+// can see. Each user keeps their own state, so contributors and viewers of a
+// shared folder do not affect each other.
+func (ic *ItemController) SetItemState(folderID int, itemID int, userID int, state string) (model.ItemState, error) {
+	if !validItemState(state) {
+		return model.ItemState{}, fmt.Errorf("unknown state %q", state)
+	}
+	var itemState model.ItemState
+	err := ic.DB.Transaction(func(tx *gorm.DB) error {
+		var folder model.Folder
+		if err := tx.First(&folder, folderID).Error; err != nil {
+			return fmt.Errorf("folder not found: %w", err)
+		}
+		ok, err := canViewFolder(tx, folder, userID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("user does not have permission to do that")
+		}
+		var item model.Item
+		if err := tx.Where("folder_id = ?", folder.ID).First(&item, itemID).Error; err != nil {
+			return fmt.Errorf("item not found: %w", err)
+		}
+		if err := saveItemStates(tx, uint(userID), []uint{item.ID}, state); err != nil {
+			return err
+		}
+		return tx.Where("user_id = ? AND item_id = ?", userID, item.ID).First(&itemState).Error
+	})
+	if err != nil {
+		return model.ItemState{}, err
+	}
+	return itemState, nil
+}
+
+// MarkAllRead marks every item in the folder as read for the user, leaving
+// archived items alone. It returns how many items changed.
+func (ic *ItemController) MarkAllRead(folderID int, userID int) (int, error) {
+	var itemIDs []uint
+	err := ic.DB.Transaction(func(tx *gorm.DB) error {
+		var folder model.Folder
+		if err := tx.First(&folder, folderID).Error; err != nil {
+			return fmt.Errorf("folder not found: %w", err)
+		}
+		ok, err := canViewFolder(tx, folder, userID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("user does not have permission to do that")
+		}
+		done := tx.Model(&model.ItemState{}).Select("item_id").
+			Where("user_id = ? AND state IN ?", userID, []string{ItemRead, ItemArchived})
+		if err := tx.Model(&model.Item{}).
+			Where("folder_id = ? AND id NOT IN (?)", folder.ID, done).
+			Pluck("id", &itemIDs).Error; err != nil {
+			return fmt.Errorf("unable to find unread items: %w", err)
+		}
+		return saveItemStates(tx, uint(userID), itemIDs, ItemRead)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(itemIDs), nil
+}
+
+// GetItemStates returns the user's state for each of the folder's items.
+func (fc *FolderController) GetItemStates(userID int, items []*model.Item) (map[uint]string, error) {
+	return itemStates(fc.DB, userID, items)
+}
+
+// GetItemStates returns the user's state for each of the smart folder's
+// items.
+func (sc *SmartFolderController) GetItemStates(userID int, items []*model.Item) (map[uint]string, error) {
+	return itemStates(sc.DB, userID, items)
+}
+
+// itemStates returns the user's state for each of the items, by item ID.
+// Items the user has not touched are unread.
+func itemStates(db *gorm.DB, userID int, items []*model.Item) (map[uint]string, error) {
+	states := make(map[uint]string, len(items))
+	itemIDs := make([]uint, 0, len(items))
+	for _, item := range items {
+		states[item.ID] = ItemUnread
+		itemIDs = append(itemIDs, item.ID)
+	}
+	if len(itemIDs) == 0 {
+		return states, nil
+	}
+	var saved []model.ItemState
+	if err := db.Where("user_id = ? AND item_id IN ?", userID, itemIDs).Find(&saved).Error; err != nil {
+		return nil, fmt.Errorf("unable to get item states: %w", err)
+	}
+	for _, itemState := range saved {
+		states[itemState.ItemID] = itemState.State
+	}
+	return states, nil
+}
+
+// FilterItemsByState keeps the items in the given state. With no state,
+// everything but archived items is kept.
+func FilterItemsByState(items []*model.Item, states map[uint]string, state string) []*model.Item {
+	filtered := []*model.Item{}
+	for _, item := range items {
+		if state == "" && states[item.ID] != ItemArchived || state != "" && states[item.ID] == state {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
+
+// GetUnreadCounts counts the unread items in each of the folders for the
+// user. Folders without unread items are left out.
+func (uc *UserController) GetUnreadCounts(userID int, folders []model.Folder) (map[uint]int64, error) {
+	counts := make(map[uint]int64)
+	if len(folders) == 0 {
+		return counts, nil
+	}
+	folderIDs := make([]uint, 0, len(folders))
+	for _, folder := range folders {
+		folderIDs = append(folderIDs, folder.ID)
+	}
+	var rows []struct {
+		FolderID uint
+		Count    int64
+	}
+	touched := uc.DB.Model(&model.ItemState{}).Select("item_id").
+		Where("user_id = ? AND state <> ?", userID, ItemUnread)
+	if err := uc.DB.Model(&model.Item{}).
+		Select("folder_id, COUNT(*) AS count").
+		Where("folder_id IN ? AND id NOT IN (?)", folderIDs, touched).
+		Group("folder_id").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("unable to count unread items: %w", err)
+	}
+	for _, row := range rows {
+		counts[row.FolderID] = row.Count
+	}
+	return counts, nil
+}
+
+// saveItemStates moves the items into state for the user, stamping the time
+// they entered it.
+func saveItemStates(tx *gorm.DB, userID uint, itemIDs []uint, state string) error {
+	if len(itemIDs) == 0 {
+		return nil
+	}
+	now := time.Now()
+	columns := []string{"state", "updated_at"}
+	var startedAt, readAt, archivedAt *time.Time
+	switch state {
+	case ItemReading:
+		startedAt = &now
+		columns = append(columns, "started_at")
+	case ItemRead:
+		readAt = &now
+		columns = append(columns, "read_at")
+	case ItemArchived:
+		archivedAt = &now
+		columns = append(columns, "archived_at")
+	}
+	itemStates := make([]model.ItemState, 0, len(itemIDs))
+	for _, itemID := range itemIDs {
+		itemStates = append(itemStates, model.ItemState{
+			UserID:     userID,
+			ItemID:     itemID,
+			State:      state,
+			StartedAt:  startedAt,
+			ReadAt:     readAt,
+			ArchivedAt: archivedAt,
+		})
+	}
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "item_id"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).Create(&itemStates).Error; err != nil {
+		return fmt.Errorf("unable to save item states: %w", err)
+	}
+	return nil
+}
+
+func validItemState(state string) bool {
+	for _, s := range ItemStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
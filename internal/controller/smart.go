@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"twilu/internal/model"
+)
+
+const (
+	// smartFolderLimit caps how many items a smart folder shows.
+	smartFolderLimit = 200
+	// maxSmartFolderDays caps the "added within" rule at about ten years.
+	maxSmartFolderDays = 3650
+)
+
+// SmartFolderController handles folders whose items are picked by rules.
+type SmartFolderController struct {
+	DB *gorm.DB
+}
+
+// NewSmartFolderController creates a new instance of SmartFolderController.
+func NewSmartFolderController(db *gorm.DB) *SmartFolderController {
+	return &SmartFolderController{DB: db}
+}
+
+// smartFolderRules cleans up the rules of a smart folder and checks that at
+// least one of them is set.
+func smartFolderRules(smart *model.SmartFolder) error {
+	smart.Name = strings.TrimSpace(smart.Name)
+	if smart.Name == "" {
+		return fmt.Errorf("smart folder name must not be blank")
+	}
+	smart.Tag = NormalizeTag(smart.Tag)
+	if len(smart.Tag) > maxTagLength {
+		return fmt.Errorf("tag %q is longer than %d characters", smart.Tag, maxTagLength)
+	}
+	domain := strings.ToLower(strings.TrimSpace(smart.Domain))
+	if strings.Contains(domain, "://") {
+		parsed, err := url.Parse(domain)
+		if err != nil {
+			return fmt.Errorf("invalid domain: %w", err)
+		}
+		domain = parsed.Hostname()
+	}
+	smart.Domain = strings.TrimPrefix(strings.Trim(domain, "/."), "www.")
+	if strings.ContainsAny(smart.Domain, "/ ") {
+		return fmt.Errorf("domain must be a host name such as github.com")
+	}
+	if smart.AddedWithinDays < 0 || smart.AddedWithinDays > maxSmartFolderDays {
+		return fmt.Errorf("added within must be between 0 and %d days", maxSmartFolderDays)
+	}
+	if smart.Tag == "" && smart.Domain == "" && smart.AddedWithinDays == 0 && !smart.BrokenOnly {
+		return fmt.Errorf("a smart folder needs at least one rule")
+	}
+	return nil
+}
+
+// ownedSmartFolder returns the smart folder if the user owns it.
+func (sc *SmartFolderController) ownedSmartFolder(smartID int, userID int) (model.SmartFolder, error) {
+	var smart model.SmartFolder
+	if err := sc.DB.Where("owner_id = ?", userID).First(&smart, smartID).Error; err != nil {
+		return model.SmartFolder{}, fmt.Errorf("smart folder not found: %w", err)
+	}
+	return smart, nil
+}
+func (sc *SmartFolderController) GetSmartFolders(userID int) ([]model.SmartFolder, error) {
+	var smartFolders []model.SmartFolder
+	if err := sc.DB.Where("owner_id = ?", userID).Order("name ASC").Find(&smartFolders).Error; err != nil {
+		return []model.SmartFolder{}, err
+	}
+	return smartFolders, nil
+}
+func (sc *SmartFolderController) CreateSmartFolder(smart model.SmartFolder, userID int) (model.SmartFolder, error) {
+	if err := smartFolderRules(&smart); err != nil {
+		return model.SmartFolder{}, err
+	}
+	smart.OwnerID = uint(userID)
+	if err := sc.DB.Create(&smart).Error; err != nil {
+		return model.SmartFolder{}, fmt.Errorf("failed to create smart folder: %w", err)
+	}
+	return smart, nil
+}
+func (sc *SmartFolderController) UpdateSmartFolder(smartID int, userID int, changes model.SmartFolder) (model.SmartFolder, error) {
+	smart, err := sc.ownedSmartFolder(smartID, userID)
+	if err != nil {
+		return model.SmartFolder{}, err
+	}
+	if err := smartFolderRules(&changes); err != nil {
+		return model.SmartFolder{}, err
+	}
+	smart.Name = changes.Name
+	smart.Tag = changes.Tag
+	smart.Domain = changes.Domain
+	smart.AddedWithinDays = changes.AddedWithinDays
+	smart.BrokenOnly = changes.BrokenOnly
+	if err := sc.DB.Model(&smart).Select("Name", "Tag", "Domain", "AddedWithinDays", "BrokenOnly").Updates(&smart).Error; err != nil {
+		return model.SmartFolder{}, fmt.Errorf("unable to update smart folder: %w", err)
+	}
+	return smart, nil
+}
+func (sc *SmartFolderController) DeleteSmartFolder(smartID int, userID int) (model.SmartFolder, error) {
+	smart, err := sc.ownedSmartFolder(smartID, userID)
+	if err != nil {
+		return model.SmartFolder{}, err
+	}
+	if err := sc.DB.Delete(&smart).Error; err != nil {
+		return model.SmartFolder{}, fmt.Errorf("unable to delete smart folder: %w", err)
+	}
+	return smart, nil
+}
+
+// GetSmartFolder returns the smart folder with the items that currently
+// match its rules, newest first. Items are drawn from the folders the user
+// owns or contributes to, leaving out folders in the trash.
+func (sc *SmartFolderController) GetSmartFolder(smartID int, userID int) (model.SmartFolder, []*model.Item, error) {
+	smart, err := sc.ownedSmartFolder(smartID, userID)
+	if err != nil {
+		return model.SmartFolder{}, nil, err
+	}
+	contributed := sc.DB.Table("folder_contributors").Select("folder_id").Where("user_id = ?", userID)
+	reachable := sc.DB.Model(&model.Folder{}).Select("id").Where("owner = ? OR id IN (?)", userID, contributed)
+	db := sc.DB.Where("folder_id IN (?)", reachable)
+	if smart.Tag != "" {
+		tagged := sc.DB.Table("folder_tags").
+			Select("folder_tags.folder_id").
+			Joins("JOIN tags ON tags.id = folder_tags.tag_id").
+			Where("tags.name = ?", smart.Tag)
+		db = db.Where("folder_id IN (?)", tagged)
+	}
+	if smart.Domain != "" {
+		// The host is the domain or one of its subdomains.
+		db = db.Where("url ~* ?", `^https?://([^/?#@]*@)?([^/?#@]*\.)?`+regexp.QuoteMeta(smart.Domain)+`(:[0-9]+)?([/?#]|$)`)
+	}
+	if smart.AddedWithinDays > 0 {
+		db = db.Where("created_at >= ?", time.Now().AddDate(0, 0, -smart.AddedWithinDays))
+	}
+	if smart.BrokenOnly {
+		db = db.Where("link_broken = ?", true)
+	}
+	var items []*model.Item
+	if err := db.Order("created_at DESC").Limit(smartFolderLimit).Find(&items).Error; err != nil {
+		return model.SmartFolder{}, nil, err
+	}
+	return smart, items, nil
+}
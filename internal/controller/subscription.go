@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"twilu/internal/feed"
+	"twilu/internal/model"
+	"twilu/internal/netguard"
+)
+
+const (
+	// feedPollInterval is how often each subscribed feed is fetched.
+	feedPollInterval = 30 * time.Minute
+	// feedPollBatch caps how many feeds one run of the poller fetches.
+	feedPollBatch = 50
+	// maxFeedEntries caps how many new entries one fetch adds to a folder,
+	// so that subscribing to a long feed doesn't flood it.
+	maxFeedEntries = 50
+	// maxFeedSize caps how much of a feed is read.
+	maxFeedSize = 5 << 20
+)
+
+// SubscriptionController handles the feeds folders are subscribed to, and
+// polls them for new entries.
+type SubscriptionController struct {
+	DB     *gorm.DB
+	Client *http.Client
+	Items  *ItemController
+}
+
+// NewSubscriptionController creates a new instance of SubscriptionController.
+// Its client refuses to connect to internal addresses, as what a feed returns
+// ends up in the folder and in LastError.
+func NewSubscriptionController(db *gorm.DB, items *ItemController) *SubscriptionController {
+	return &SubscriptionController{DB: db, Client: netguard.NewClient(20 * time.Second), Items: items}
+}
+
+// ownedSubscription returns the subscription if the user owns its folder.
+func (sc *SubscriptionController) ownedSubscription(subscriptionID int, userID int) (model.FeedSubscription, error) {
+	var subscription model.FeedSubscription
+	if err := sc.DB.First(&subscription, subscriptionID).Error; err != nil {
+		return model.FeedSubscription{}, fmt.Errorf("subscription not found: %w", err)
+	}
+	if _, err := ownedFolder(sc.DB, subscription.FolderID, userID); err != nil {
+		return model.FeedSubscription{}, err
+	}
+	return subscription, nil
+}
+func (sc *SubscriptionController) GetSubscriptions(folderID int, userID int) ([]model.FeedSubscription, error) {
+	if _, err := ownedFolder(sc.DB, uint(folderID), userID); err != nil {
+		return []model.FeedSubscription{}, err
+	}
+	var subscriptions []model.FeedSubscription
+	if err := sc.DB.Where("folder_id = ?", folderID).Order("created_at DESC").Find(&subscriptions).Error; err != nil {
+		return []model.FeedSubscription{}, err
+	}
+	return subscriptions, nil
+}
+
+// Subscribe attaches a feed to one of the user's folders and fetches it right
+// away, so that a URL that isn't a feed shows up as an error immediately.
+func (sc *SubscriptionController) Subscribe(folderID int, userID int, target string) (model.FeedSubscription, error) {
+	parsed, err := url.Parse(strings.TrimSpace(target))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return model.FeedSubscription{}, fmt.Errorf("feed URL must be an http or https URL")
+	}
+	folder, err := ownedFolder(sc.DB, uint(folderID), userID)
+	if err != nil {
+		return model.FeedSubscription{}, err
+	}
+	var count int64
+	if err := sc.DB.Model(&model.FeedSubscription{}).Where("folder_id = ? AND url = ?", folder.ID, parsed.String()).Count(&count).Error; err != nil {
+		return model.FeedSubscription{}, err
+	}
+	if count > 0 {
+		return model.FeedSubscription{}, fmt.Errorf("folder is already subscribed to that feed")
+	}
+	subscription := model.FeedSubscription{FolderID: folder.ID, URL: parsed.String()}
+	if err := sc.DB.Create(&subscription).Error; err != nil {
+		return model.FeedSubscription{}, fmt.Errorf("failed to create subscription: %w", err)
+	}
+	if err := sc.poll(&subscription); err != nil {
+		return model.FeedSubscription{}, err
+	}
+	return subscription, nil
+}
+func (sc *SubscriptionController) Unsubscribe(subscriptionID int, userID int) (model.FeedSubscription, error) {
+	subscription, err := sc.ownedSubscription(subscriptionID, userID)
+	if err != nil {
+		return model.FeedSubscription{}, err
+	}
+	if err := sc.DB.Delete(&subscription).Error; err != nil {
+		return model.FeedSubscription{}, fmt.Errorf("unable to delete subscription: %w", err)
+	}
+	return subscription, nil
+}
+
+// PollFeeds fetches the subscribed feeds that are due and adds their new
+// entries. Feeds of folders in the trash are left alone until restored.
+func (sc *SubscriptionController) PollFeeds() error {
+	var subscriptions []model.FeedSubscription
+	if err := sc.DB.Joins("JOIN folders ON folders.id = feed_subscriptions.folder_id AND folders.deleted_at IS NULL").
+		Where("feed_subscriptions.last_polled_at IS NULL OR feed_subscriptions.last_polled_at < ?", time.Now().Add(-feedPollInterval)).
+		Order("feed_subscriptions.last_polled_at ASC NULLS FIRST").
+		Limit(feedPollBatch).
+		Find(&subscriptions).Error; err != nil {
+		return err
+	}
+	for i := range subscriptions {
+		if err := sc.poll(&subscriptions[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// poll fetches the subscription's feed and adds its new entries to the folder
+// as the folder's owner. Problems with the feed itself are kept in LastError
+// rather than returned, so that one bad feed doesn't hold up the others.
+func (sc *SubscriptionController) poll(subscription *model.FeedSubscription) error {
+	now := time.Now()
+	subscription.LastPolledAt = &now
+	subscription.LastError = ""
+	if err := sc.fetch(subscription); err != nil {
+		subscription.LastError = err.Error()
+	}
+	if err := sc.DB.Select("Title", "ETag", "LastModified", "LastPolledAt", "LastError").Save(subscription).Error; err != nil {
+		return fmt.Errorf("unable to record poll of subscription %d: %w", subscription.ID, err)
+	}
+	return nil
+}
+
+// fetch downloads the feed unless it is unchanged since the last fetch, and
+// adds the entries the folder doesn't have yet.
+func (sc *SubscriptionController) fetch(subscription *model.FeedSubscription) error {
+	req, err := http.NewRequest(http.MethodGet, subscription.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Twilu-Feeds/1.0")
+	req.Header.Set("Accept", "application/atom+xml, application/rss+xml, application/xml;q=0.9, */*;q=0.8")
+	if subscription.ETag != "" {
+		req.Header.Set("If-None-Match", subscription.ETag)
+	}
+	if subscription.LastModified != "" {
+		req.Header.Set("If-Modified-Since", subscription.LastModified)
+	}
+	resp, err := sc.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("feed responded with %s", resp.Status)
+	}
+	parsed, err := feed.Parse(io.LimitReader(resp.Body, maxFeedSize))
+	if err != nil {
+		return err
+	}
+
+	var folder model.Folder
+	if err := sc.DB.First(&folder, subscription.FolderID).Error; err != nil {
+		return fmt.Errorf("folder not found: %w", err)
+	}
+	if parsed.Title != "" {
+		subscription.Title = parsed.Title
+	}
+	entries := parsed.Entries
+	if len(entries) > maxFeedEntries {
+		entries = entries[:maxFeedEntries]
+	}
+	// Feeds list their newest entries first; adding them oldest first keeps
+	// the folder in publishing order.
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		// As with quick save, only web pages are kept, so that a feed can't
+		// put javascript: or data: links in the folder.
+		link, err := url.Parse(entry.URL)
+		if err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Host == "" {
+			continue
+		}
+		var count int64
+		// Items in the trash count too, so that deleting an entry's item
+		// doesn't bring it back on the next poll.
+		if err := sc.DB.Unscoped().Model(&model.Item{}).
+			Where("folder_id = ? AND (guid = ? OR url = ?)", folder.ID, entry.ID, entry.URL).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		item := model.Item{Name: entry.Title, URL: entry.URL, GUID: entry.ID}
+		if _, err := sc.Items.AddItemToFolder(int(folder.ID), item, int(folder.Owner)); err != nil {
+			return fmt.Errorf("unable to add feed entry: %w", err)
+		}
+	}
+
+	// The validators are only kept once the entries are in, so that a fetch
+	// that failed halfway is retried in full.
+	subscription.ETag = resp.Header.Get("ETag")
+	subscription.LastModified = resp.Header.Get("Last-Modified")
+	return nil
+}
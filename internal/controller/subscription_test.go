@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"twilu/internal/model"
+	"twilu/internal/netguard"
+	"twilu/internal/realtime"
+)
+
+// testFeed serves an RSS feed whose entries and ETag can be changed between
+// polls, and answers conditional requests for the current ETag with 304.
+type testFeed struct {
+	*httptest.Server
+	mu          sync.Mutex
+	etag        string
+	entries     []string
+	notModified int
+}
+
+func newTestFeed(t *testing.T) *testFeed {
+	t.Helper()
+	f := &testFeed{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if r.Header.Get("If-None-Match") == f.etag {
+			f.notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", f.etag)
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Test feed</title>`)
+		for _, entry := range f.entries {
+			fmt.Fprint(w, entry)
+		}
+		fmt.Fprint(w, `</channel></rss>`)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *testFeed) serve(etag string, entries ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.etag, f.entries = etag, entries
+}
+
+func entry(title, guid, link string) string {
+	if guid == "" {
+		return fmt.Sprintf(`<item><title>%s</title><link>%s</link></item>`, title, link)
+	}
+	return fmt.Sprintf(`<item><title>%s</title><guid>%s</guid><link>%s</link></item>`, title, guid, link)
+}
+
+func TestSubscriptionPolling(t *testing.T) {
+	db := testDB(t)
+	owner := model.User{Email: "feeds@example.com", Username: "feeds", Password: "x"}
+	if err := db.Create(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+	folder := model.Folder{Name: "Reading", Owner: owner.ID, OwnerUsername: owner.Username}
+	if err := db.Create(&folder).Error; err != nil {
+		t.Fatal(err)
+	}
+	server := newTestFeed(t)
+	// The httptest server listens on loopback, which the guarded client of
+	// NewSubscriptionController would refuse.
+	sc := &SubscriptionController{DB: db, Client: server.Client(), Items: NewItemController(db, realtime.NewBroker())}
+	items := func() int64 {
+		var count int64
+		db.Unscoped().Model(&model.Item{}).Where("folder_id = ?", folder.ID).Count(&count)
+		return count
+	}
+
+	server.serve(`"v1"`,
+		entry("Second", "urn:second", server.URL+"/second"),
+		entry("Script", "urn:script", "javascript:alert(1)"),
+		entry("Data", "urn:data", "data:text/html,hello"),
+		entry("Relative", "urn:relative", "/relative"),
+		entry("First", "", server.URL+"/first"))
+	subscription, err := sc.Subscribe(int(folder.ID), int(owner.ID), server.URL)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if subscription.LastError != "" || subscription.Title != "Test feed" || subscription.ETag != `"v1"` {
+		t.Fatalf("Subscribe() = %+v", subscription)
+	}
+	if got := items(); got != 2 {
+		t.Fatalf("folder has %d items after the first poll, want 2 as only http and https entries are kept", got)
+	}
+
+	// An unchanged feed answers 304 and adds nothing.
+	if err := sc.poll(&subscription); err != nil {
+		t.Fatal(err)
+	}
+	if server.notModified != 1 || subscription.LastError != "" {
+		t.Fatalf("second poll: %d not modified responses, last error %q", server.notModified, subscription.LastError)
+	}
+	if got := items(); got != 2 {
+		t.Fatalf("folder has %d items after a 304, want 2", got)
+	}
+
+	// Entries already in the folder are matched by GUID even if their link
+	// changed, and by URL when they have no GUID of their own.
+	server.serve(`"v2"`,
+		entry("Third", "urn:third", server.URL+"/third"),
+		entry("Second, moved", "urn:second", server.URL+"/second-moved"),
+		entry("First again", "", server.URL+"/first"))
+	if err := sc.poll(&subscription); err != nil {
+		t.Fatal(err)
+	}
+	if got := items(); got != 3 {
+		t.Fatalf("folder has %d items after the feed changed, want 3", got)
+	}
+
+	// Deleting an entry's item doesn't bring it back on the next poll.
+	if err := db.Where("folder_id = ? AND guid = ?", folder.ID, "urn:third").Delete(&model.Item{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	server.serve(`"v3"`, entry("Third", "urn:third", server.URL+"/third"))
+	if err := sc.poll(&subscription); err != nil {
+		t.Fatal(err)
+	}
+	if got := items(); got != 3 {
+		t.Fatalf("folder has %d items after a deleted entry was polled again, want 3", got)
+	}
+}
+
+func TestSubscriptionClientRefusesInternalAddresses(t *testing.T) {
+	server := newTestFeed(t)
+	sc := NewSubscriptionController(nil, nil)
+	if _, err := sc.Client.Get(server.URL); !errors.Is(err, netguard.ErrBlocked) {
+		t.Fatalf("Get(%s) error = %v, want netguard.ErrBlocked", server.URL, err)
+	}
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"twilu/internal/model"
+)
+
+// syndicationLimit is how many of the newest items a folder or profile feed
+// lists.
+const syndicationLimit = 50
+
+// SyndicatedItem is an item of a public folder, with the folder's name for
+// feeds that span several folders.
+type SyndicatedItem struct {
+	model.Item `gorm:"embedded"`
+	FolderName string
+}
+
+// GetPublicFolder returns a public folder with its newest items. Private and
+// missing folders, and folders of accounts scheduled for deletion, are all
+// reported as not found.
+func (fc *FolderController) GetPublicFolder(folderID int) (model.Folder, error) {
+	var folder model.Folder
+	active := fc.DB.Model(&model.User{}).Select("id").Where("deletion_requested_at IS NULL")
+	if err := fc.DB.Where("private = ? AND owner IN (?)", false, active).
+		Preload("Items", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at DESC").Limit(syndicationLimit)
+		}).
+		First(&folder, folderID).Error; err != nil {
+		return model.Folder{}, fmt.Errorf("folder not found: %w", err)
+	}
+	return folder, nil
+}
+
+// GetPublicItems returns the newest items across the user's public folders.
+func (uc *UserController) GetPublicItems(username string) (model.User, []SyndicatedItem, error) {
+	user, err := uc.GetUserByUsername(username)
+	if err != nil {
+		return model.User{}, nil, fmt.Errorf("user not found: %w", err)
+	}
+	if user.DeletionRequestedAt != nil {
+		return model.User{}, nil, fmt.Errorf("user not found: %w", gorm.ErrRecordNotFound)
+	}
+	var items []SyndicatedItem
+	if err := uc.DB.Model(&model.Item{}).
+		Select("items.*, folders.name AS folder_name").
+		Joins("JOIN folders ON folders.id = items.folder_id AND folders.deleted_at IS NULL").
+		Where("folders.owner = ? AND folders.private = ?", user.ID, false).
+		Order("items.created_at DESC").
+		Limit(syndicationLimit).
+		Scan(&items).Error; err != nil {
+		return model.User{}, nil, err
+	}
+	return user, items, nil
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"twilu/internal/model"
+)
+
+const (
+	// maxFolderTags caps how many tags a folder can have.
+	maxFolderTags = 10
+	// maxTagLength caps the length of a single tag.
+	maxTagLength = 32
+)
+
+// NormalizeTag lowercases a tag and strips surrounding spaces and a leading #.
+func NormalizeTag(name string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "#")
+}
+
+// ParseTags splits a comma separated list of tags, dropping blanks and
+// duplicates.
+func ParseTags(raw string) ([]*model.Tag, error) {
+	var tags []*model.Tag
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(raw, ",") {
+		name = NormalizeTag(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if len(name) > maxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", name, maxTagLength)
+		}
+		seen[name] = true
+		tags = append(tags, &model.Tag{Name: name})
+	}
+	if len(tags) > maxFolderTags {
+		return nil, fmt.Errorf("a folder can have at most %d tags", maxFolderTags)
+	}
+	return tags, nil
+}
+
+// setFolderTags replaces the folder's tags, creating the ones that don't
+// exist yet.
+func setFolderTags(tx *gorm.DB, folder *model.Folder, tags []*model.Tag) error {
+	resolved := make([]*model.Tag, 0, len(tags))
+	for _, tag := range tags {
+		var existing model.Tag
+		if err := tx.Where(model.Tag{Name: tag.Name}).FirstOrCreate(&existing).Error; err != nil {
+			return fmt.Errorf("unable to create tag: %w", err)
+		}
+		resolved = append(resolved, &existing)
+	}
+	if err := tx.Model(folder).Association("Tags").Replace(resolved); err != nil {
+		return fmt.Errorf("unable to set tags: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"gorm.io/gorm"
+	"slices"
+	"strings"
+	"time"
+	"twilu/internal/model"
+)
+
+// Scopes that can be granted to a personal API token.
+const (
+	ScopeFoldersRead  = "folders:read"
+	ScopeFoldersWrite = "folders:write"
+	ScopeItemsWrite   = "items:write"
+	ScopeAccountRead  = "account:read"
+)
+
+// TokenScopes lists every scope a user may pick when creating a token.
+var TokenScopes = []string{ScopeFoldersRead, ScopeFoldersWrite, ScopeItemsWrite, ScopeAccountRead}
+
+// MaxTokenLifetime caps how long a personal API token stays valid.
+const MaxTokenLifetime = 365 * 24 * time.Hour
+
+const tokenPrefix = "twl_"
+
+// TokenController handles operations on personal API tokens.
+type TokenController struct {
+	DB *gorm.DB
+}
+
+// NewTokenController creates a new instance of TokenController.
+func NewTokenController(db *gorm.DB) *TokenController {
+	return &TokenController{DB: db}
+}
+
+// CreateToken stores a new token for the user and returns its plaintext value.
+// Only a hash is persisted, so the plaintext cannot be recovered later.
+func (tc *TokenController) CreateToken(userID int, name string, scopes []string, lifetime time.Duration) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("token name must not be blank")
+	}
+	if len(scopes) == 0 {
+		return "", fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(TokenScopes, scope) {
+			return "", fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	if lifetime <= 0 || lifetime > MaxTokenLifetime {
+		return "", fmt.Errorf("token lifetime must be between 1 and 365 days")
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	raw := tokenPrefix + hex.EncodeToString(secret)
+	token := model.APIToken{
+		UserID:    uint(userID),
+		Name:      name,
+		Prefix:    raw[:len(tokenPrefix)+6],
+		TokenHash: hashToken(raw),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: time.Now().Add(lifetime),
+	}
+	if err := tc.DB.Create(&token).Error; err != nil {
+		return "", fmt.Errorf("failed to create token: %w", err)
+	}
+	return raw, nil
+}
+func (tc *TokenController) GetTokens(userID int) ([]model.APIToken, error) {
+	var tokens []model.APIToken
+	if err := tc.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return []model.APIToken{}, err
+	}
+	return tokens, nil
+}
+func (tc *TokenController) DeleteToken(tokenID int, userID int) error {
+	result := tc.DB.Unscoped().Where("id = ? AND user_id = ?", tokenID, userID).Delete(&model.APIToken{})
+	if result.Error != nil {
+		return fmt.Errorf("unable to delete token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("token not found")
+	}
+	return nil
+}
+
+// Authenticate resolves a plaintext token to its stored record and records
+// when it was last used. Expired tokens, and tokens of accounts scheduled for
+// deletion, are rejected.
+func (tc *TokenController) Authenticate(raw string) (model.APIToken, error) {
+	var token model.APIToken
+	if !strings.HasPrefix(raw, tokenPrefix) {
+		return model.APIToken{}, fmt.Errorf("malformed token")
+	}
+	if err := tc.DB.Where("token_hash = ?", hashToken(raw)).First(&token).Error; err != nil {
+		return model.APIToken{}, fmt.Errorf("token not found: %w", err)
+	}
+	now := time.Now()
+	if now.After(token.ExpiresAt) {
+		return model.APIToken{}, fmt.Errorf("token expired")
+	}
+	var user model.User
+	if err := tc.DB.Select("id", "deletion_requested_at").First(&user, token.UserID).Error; err != nil {
+		return model.APIToken{}, fmt.Errorf("token owner not found: %w", err)
+	}
+	if user.DeletionRequestedAt != nil {
+		return model.APIToken{}, fmt.Errorf("account is scheduled for deletion")
+	}
+	if err := tc.DB.Model(&token).UpdateColumn("last_used_at", now).Error; err != nil {
+		return model.APIToken{}, err
+	}
+	return token, nil
+}
+
+// TokenHasScope reports whether the token was granted the given scope.
+func TokenHasScope(token model.APIToken, scope string) bool {
+	return slices.Contains(strings.Split(token.Scopes, ","), scope)
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"time"
+	"twilu/internal/model"
+)
+
+// TrashController handles folders and items that were deleted but can still
+// be restored.
+type TrashController struct {
+	DB *gorm.DB
+	// Retention is how long deleted folders and items are kept before they
+	// are purged for good.
+	Retention time.Duration
+}
+
+// NewTrashController creates a new instance of TrashController.
+func NewTrashController(db *gorm.DB, retention time.Duration) *TrashController {
+	return &TrashController{DB: db, Retention: retention}
+}
+
+// GetTrash returns the user's deleted folders, and items deleted individually
+// that they added or that were in their folders. Items inside a deleted folder
+// are restored with the folder, and so are subfolders deleted along with it.
+func (tc *TrashController) GetTrash(userID int) ([]model.Folder, []model.Item, error) {
+	var folders []model.Folder
+	if err := tc.DB.Unscoped().
+		Where("owner = ? AND deleted_at IS NOT NULL", userID).
+		Where("NOT EXISTS (SELECT 1 FROM folders AS parents WHERE parents.id = folders.parent_id AND parents.deleted_at = folders.deleted_at)").
+		Order("deleted_at DESC").
+		Find(&folders).Error; err != nil {
+		return []model.Folder{}, []model.Item{}, err
+	}
+	var items []model.Item
+	if err := tc.DB.Unscoped().
+		Where("(owner_id = ? OR folder_id IN (?)) AND deleted_at IS NOT NULL", userID, ownedFolders(tc.DB, userID)).
+		Where("folder_id IN (?)", tc.DB.Model(&model.Folder{}).Select("id")).
+		Order("deleted_at DESC").
+		Find(&items).Error; err != nil {
+		return []model.Folder{}, []model.Item{}, err
+	}
+	return folders, items, nil
+}
+
+// RestoreFolder takes the folder out of the trash, along with the subfolders
+// that were deleted with it. A folder whose parent is still in the trash is
+// restored to the top level.
+func (tc *TrashController) RestoreFolder(folderID int, userID int) error {
+	return tc.DB.Transaction(func(tx *gorm.DB) error {
+		var folder model.Folder
+		if err := tx.Unscoped().Where("owner = ? AND deleted_at IS NOT NULL", userID).First(&folder, folderID).Error; err != nil {
+			return fmt.Errorf("folder not found in trash: %w", err)
+		}
+		descendants, err := folderDescendants(tx.Unscoped(), folder.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&model.Folder{}).
+			Where("id IN ? AND deleted_at = ?", append(descendants, folder.ID), folder.DeletedAt).
+			Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("unable to restore folder: %w", err)
+		}
+		if folder.ParentID == nil {
+			return nil
+		}
+		var parents int64
+		if err := tx.Model(&model.Folder{}).Where("id = ?", *folder.ParentID).Count(&parents).Error; err != nil {
+			return err
+		}
+		if parents == 0 {
+			return tx.Model(&folder).Update("parent_id", nil).Error
+		}
+		return nil
+	})
+}
+func (tc *TrashController) RestoreItem(itemID int, userID int) error {
+	var item model.Item
+	if err := tc.DB.Unscoped().
+		Where("(owner_id = ? OR folder_id IN (?)) AND deleted_at IS NOT NULL", userID, ownedFolders(tc.DB, userID)).
+		First(&item, itemID).Error; err != nil {
+		return fmt.Errorf("item not found in trash: %w", err)
+	}
+	var folder model.Folder
+	if err := tc.DB.First(&folder, item.FolderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("restore the item's folder first")
+		}
+		return err
+	}
+	// The item's owner may have been removed from the folder since.
+	if folder.Owner != uint(userID) {
+		contributor, err := isContributor(tc.DB, folder.ID, userID)
+		if err != nil {
+			return err
+		}
+		if !contributor {
+			return fmt.Errorf("user does not have permission to do that")
+		}
+	}
+	return tc.DB.Unscoped().Model(&item).Update("deleted_at", nil).Error
+}
+func (tc *TrashController) PurgeFolder(folderID int, userID int) error {
+	return tc.DB.Transaction(func(tx *gorm.DB) error {
+		var folder model.Folder
+		if err := tx.Unscoped().Where("owner = ? AND deleted_at IS NOT NULL", userID).First(&folder, folderID).Error; err != nil {
+			return fmt.Errorf("folder not found in trash: %w", err)
+		}
+		descendants, err := folderDescendants(tx.Unscoped(), folder.ID)
+		if err != nil {
+			return err
+		}
+		var subfolders []model.Folder
+		if err := tx.Unscoped().Where("id IN ?", descendants).Find(&subfolders).Error; err != nil {
+			return err
+		}
+		for _, subfolder := range append(subfolders, folder) {
+			if err := purgeFolder(tx, subfolder); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+func (tc *TrashController) PurgeItem(itemID int, userID int) error {
+	return tc.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().
+			Where("id = ? AND (owner_id = ? OR folder_id IN (?)) AND deleted_at IS NOT NULL", itemID, userID, ownedFolders(tx, userID)).
+			Delete(&model.Item{})
+		if result.Error != nil {
+			return fmt.Errorf("unable to delete item: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("item not found in trash")
+		}
+		if err := tx.Where("item_id = ?", itemID).Delete(&model.Comment{}).Error; err != nil {
+			return fmt.Errorf("unable to delete comments: %w", err)
+		}
+		if err := tx.Where("item_id = ?", itemID).Delete(&model.ItemState{}).Error; err != nil {
+			return fmt.Errorf("unable to delete item states: %w", err)
+		}
+		return nil
+	})
+}
+
+// PurgeExpired permanently deletes everything that has been in the trash for
+// longer than the retention period. A folder that can't be purged is logged
+// and left for the next run, so that it doesn't hold up the rest.
+func (tc *TrashController) PurgeExpired() error {
+	cutoff := time.Now().Add(-tc.Retention)
+	var folders []model.Folder
+	if err := tc.DB.Unscoped().Where("deleted_at <= ?", cutoff).Find(&folders).Error; err != nil {
+		return err
+	}
+	for _, folder := range folders {
+		if err := tc.DB.Transaction(func(tx *gorm.DB) error {
+			return purgeFolder(tx, folder)
+		}); err != nil {
+			log.Printf("unable to purge folder %d: %v", folder.ID, err)
+		}
+	}
+	return tc.DB.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Unscoped().Model(&model.Item{}).Select("id").Where("deleted_at <= ?", cutoff)
+		if err := tx.Where("item_id IN (?)", expired).Delete(&model.Comment{}).Error; err != nil {
+			return fmt.Errorf("unable to purge comments: %w", err)
+		}
+		if err := tx.Where("item_id IN (?)", expired).Delete(&model.ItemState{}).Error; err != nil {
+			return fmt.Errorf("unable to purge item states: %w", err)
+		}
+		if err := tx.Unscoped().Where("deleted_at <= ?", cutoff).Delete(&model.Item{}).Error; err != nil {
+			return fmt.Errorf("unable to purge items: %w", err)
+		}
+		return nil
+	})
+}
+
+// purgeFolder permanently deletes a folder, its items and its associations.
+func purgeFolder(tx *gorm.DB, folder model.Folder) error {
+	if err := tx.Exec("DELETE FROM folder_contributors WHERE folder_id = ?", folder.ID).Error; err != nil {
+		return fmt.Errorf("unable to clear folder contributors: %w", err)
+	}
+	if err := tx.Exec("DELETE FROM user_folders WHERE folder_id = ?", folder.ID).Error; err != nil {
+		return fmt.Errorf("unable to remove folder from user's folders: %w", err)
+	}
+	if err := tx.Exec("DELETE FROM folder_tags WHERE folder_id = ?", folder.ID).Error; err != nil {
+		return fmt.Errorf("unable to clear folder tags: %w", err)
+	}
+	if err := tx.Where("item_id IN (?)", tx.Unscoped().Model(&model.Item{}).Select("id").Where("folder_id = ?", folder.ID)).Delete(&model.ItemState{}).Error; err != nil {
+		return fmt.Errorf("unable to delete item states: %w", err)
+	}
+	if err := tx.Unscoped().Where("folder_id = ?", folder.ID).Delete(&model.Item{}).Error; err != nil {
+		return fmt.Errorf("unable to delete items: %w", err)
+	}
+	if err := tx.Where("folder_id = ?", folder.ID).Delete(&model.FolderActivity{}).Error; err != nil {
+		return fmt.Errorf("unable to delete folder activity: %w", err)
+	}
+	if err := tx.Where("folder_id = ?", folder.ID).Delete(&model.FolderLike{}).Error; err != nil {
+		return fmt.Errorf("unable to delete likes: %w", err)
+	}
+	if err := tx.Where("folder_id = ?", folder.ID).Delete(&model.SavedFolder{}).Error; err != nil {
+		return fmt.Errorf("unable to delete saves: %w", err)
+	}
+	if err := tx.Where("folder_id = ?", folder.ID).Delete(&model.Comment{}).Error; err != nil {
+		return fmt.Errorf("unable to delete comments: %w", err)
+	}
+	if err := tx.Where("folder_id = ?", folder.ID).Delete(&model.Notification{}).Error; err != nil {
+		return fmt.Errorf("unable to delete notifications: %w", err)
+	}
+	webhooks := tx.Model(&model.Webhook{}).Select("id").Where("folder_id = ?", folder.ID)
+	if err := tx.Where("webhook_id IN (?)", webhooks).Delete(&model.WebhookDelivery{}).Error; err != nil {
+		return fmt.Errorf("unable to delete webhook deliveries: %w", err)
+	}
+	if err := tx.Where("folder_id = ?", folder.ID).Delete(&model.Webhook{}).Error; err != nil {
+		return fmt.Errorf("unable to delete webhooks: %w", err)
+	}
+	if err := tx.Where("folder_id = ?", folder.ID).Delete(&model.FeedSubscription{}).Error; err != nil {
+		return fmt.Errorf("unable to delete feed subscriptions: %w", err)
+	}
+	if err := tx.Model(&model.User{}).Where("default_folder_id = ?", folder.ID).Update("default_folder_id", nil).Error; err != nil {
+		return fmt.Errorf("unable to clear default folders: %w", err)
+	}
+	if err := tx.Unscoped().Delete(&folder).Error; err != nil {
+		return fmt.Errorf("unable to delete folder: %w", err)
+	}
+	return nil
+}
+
+// ownedFolders is a subquery selecting the ids of the user's folders,
+// including those in the trash.
+func ownedFolders(db *gorm.DB, userID int) *gorm.DB {
+	return db.Unscoped().Model(&model.Folder{}).Select("id").Where("owner = ?", userID)
+}
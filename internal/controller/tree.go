@@ -0,0 +1,307 @@
+package controller
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+	"twilu/internal/model"
+)
+
+// maxFolderDepth caps how deeply folders can be nested, which also bounds the
+// walks up and down the tree.
+const maxFolderDepth = 16
+
+// FolderExport is a folder and everything under it, as written by the export
+// endpoint.
+type FolderExport struct {
+	Name       string
+	Private    bool
+	CoverURL   string
+	Tags       []string
+	CreatedAt  time.Time
+	Items      []ItemExport
+	Subfolders []FolderExport
+}
+
+// ItemExport is an item of an exported folder.
+type ItemExport struct {
+	Name      string
+	URL       string
+	Notes     string `json:",omitempty"`
+	CreatedAt time.Time
+}
+
+// folderAncestors returns the folders above the folder, root first.
+func folderAncestors(tx *gorm.DB, folder model.Folder) ([]model.Folder, error) {
+	var ancestors []model.Folder
+	for parentID := folder.ParentID; parentID != nil; {
+		if len(ancestors) >= maxFolderDepth {
+			return nil, fmt.Errorf("folder is nested too deeply")
+		}
+		var parent model.Folder
+		if err := tx.First(&parent, *parentID).Error; err != nil {
+			return nil, fmt.Errorf("parent folder not found: %w", err)
+		}
+		ancestors = append([]model.Folder{parent}, ancestors...)
+		parentID = parent.ParentID
+	}
+	return ancestors, nil
+}
+
+// folderDescendants returns the ids of every folder below the folder, level
+// by level. Pass an Unscoped tx to include folders in the trash.
+func folderDescendants(tx *gorm.DB, folderID uint) ([]uint, error) {
+	var descendants []uint
+	level := []uint{folderID}
+	for depth := 0; len(level) > 0; depth++ {
+		if depth > maxFolderDepth {
+			return nil, fmt.Errorf("folder is nested too deeply")
+		}
+		var children []uint
+		if err := tx.Model(&model.Folder{}).Where("parent_id IN ?", level).Pluck("id", &children).Error; err != nil {
+			return nil, err
+		}
+		descendants = append(descendants, children...)
+		level = children
+	}
+	return descendants, nil
+}
+
+// subtreeDepth returns how many levels there are below the folder.
+func subtreeDepth(tx *gorm.DB, folderID uint) (int, error) {
+	depth := 0
+	level := []uint{folderID}
+	for {
+		var children []uint
+		if err := tx.Model(&model.Folder{}).Where("parent_id IN ?", level).Pluck("id", &children).Error; err != nil {
+			return 0, err
+		}
+		if len(children) == 0 {
+			return depth, nil
+		}
+		depth++
+		if depth > maxFolderDepth {
+			return 0, fmt.Errorf("folder is nested too deeply")
+		}
+		level = children
+	}
+}
+
+// parentFolder returns the folder that a folder of the user is created in or
+// moved to. Only the owner may nest folders in a folder, and the inbox stays
+// flat.
+func parentFolder(tx *gorm.DB, parentID uint, userID int) (model.Folder, error) {
+	var parent model.Folder
+	if err := tx.First(&parent, parentID).Error; err != nil {
+		return model.Folder{}, fmt.Errorf("parent folder not found: %w", err)
+	}
+	if parent.Owner != uint(userID) {
+		return model.Folder{}, fmt.Errorf("user is not the owner of the parent folder")
+	}
+	if parent.Inbox {
+		return model.Folder{}, fmt.Errorf("folders can't be put in the inbox")
+	}
+	return parent, nil
+}
+
+// GetBreadcrumbs returns the folders above the folder that the user can view,
+// root first.
+func (fc *FolderController) GetBreadcrumbs(folder model.Folder, userID int) ([]model.Folder, error) {
+	ancestors, err := folderAncestors(fc.DB, folder)
+	if err != nil {
+		return []model.Folder{}, err
+	}
+	visible := []model.Folder{}
+	for _, ancestor := range ancestors {
+		ok, err := canViewFolder(fc.DB, ancestor, userID)
+		if err != nil {
+			return []model.Folder{}, err
+		}
+		if ok {
+			visible = append(visible, ancestor)
+		}
+	}
+	return visible, nil
+}
+
+// GetSubfolders returns the folders directly inside the folder that the user
+// can view.
+func (fc *FolderController) GetSubfolders(folderID int, userID int) ([]model.Folder, error) {
+	var children []model.Folder
+	if err := fc.DB.Where("parent_id = ?", folderID).Order("name ASC").Find(&children).Error; err != nil {
+		return []model.Folder{}, err
+	}
+	visible := []model.Folder{}
+	for _, child := range children {
+		ok, err := canViewFolder(fc.DB, child, userID)
+		if err != nil {
+			return []model.Folder{}, err
+		}
+		if ok {
+			visible = append(visible, child)
+		}
+	}
+	return visible, nil
+}
+
+// GetMoveTargets returns the folders of the user that the folder can be moved
+// into, leaving out the folder itself, everything below it and the inbox.
+func (fc *FolderController) GetMoveTargets(folderID int, userID int) ([]model.Folder, error) {
+	descendants, err := folderDescendants(fc.DB, uint(folderID))
+	if err != nil {
+		return []model.Folder{}, err
+	}
+	excluded := append(descendants, uint(folderID))
+	var targets []model.Folder
+	if err := fc.DB.Where("owner = ? AND inbox = ? AND id NOT IN ?", userID, false, excluded).
+		Order("name ASC").
+		Find(&targets).Error; err != nil {
+		return []model.Folder{}, err
+	}
+	return targets, nil
+}
+
+// MoveFolder puts the folder inside another of the user's folders, or back at
+// the top level when parentID is 0. Moving a folder into itself or one of its
+// subfolders is refused, and a folder moved into a private folder becomes
+// private along with its subfolders.
+func (fc *FolderController) MoveFolder(folderID int, userID int, parentID int) (model.Folder, error) {
+	var folder model.Folder
+	err := fc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&folder, folderID).Error; err != nil {
+			return fmt.Errorf("folder not found: %w", err)
+		}
+		if folder.Owner != uint(userID) {
+			return fmt.Errorf("user is not the owner")
+		}
+		if folder.Inbox {
+			return fmt.Errorf("the inbox can't be moved")
+		}
+		if parentID == 0 {
+			folder.ParentID = nil
+			return tx.Model(&folder).Update("parent_id", nil).Error
+		}
+
+		parent, err := parentFolder(tx, uint(parentID), userID)
+		if err != nil {
+			return err
+		}
+		ancestors, err := folderAncestors(tx, parent)
+		if err != nil {
+			return err
+		}
+		for _, ancestor := range append(ancestors, parent) {
+			if ancestor.ID == folder.ID {
+				return fmt.Errorf("a folder can't be moved into itself or one of its subfolders")
+			}
+		}
+		depth, err := subtreeDepth(tx, folder.ID)
+		if err != nil {
+			return err
+		}
+		// The parent's ancestors, the parent, the folder and its subtree.
+		if len(ancestors)+2+depth > maxFolderDepth {
+			return fmt.Errorf("folders can't be nested more than %d deep", maxFolderDepth)
+		}
+
+		folder.ParentID = &parent.ID
+		if err := tx.Model(&folder).Update("parent_id", parent.ID).Error; err != nil {
+			return fmt.Errorf("unable to move folder: %w", err)
+		}
+		if parent.Private && !folder.Private {
+			return makeSubtreePrivate(tx, &folder)
+		}
+		return nil
+	})
+	if err != nil {
+		return model.Folder{}, err
+	}
+	return folder, nil
+}
+
+// makeSubtreePrivate makes the folder and every folder below it private, as
+// nothing inside a private folder may be public. Folders in the trash are
+// included, so that restoring one doesn't bring back a public folder.
+func makeSubtreePrivate(tx *gorm.DB, folder *model.Folder) error {
+	descendants, err := folderDescendants(tx.Unscoped(), folder.ID)
+	if err != nil {
+		return err
+	}
+	var public []model.Folder
+	if err := tx.Unscoped().Where("id IN ? AND private = ?", append(descendants, folder.ID), false).Find(&public).Error; err != nil {
+		return err
+	}
+	for _, f := range public {
+		if err := tx.Unscoped().Model(&f).Update("private", true).Error; err != nil {
+			return fmt.Errorf("unable to make folder private: %w", err)
+		}
+		if err := recordActivity(tx, model.FolderActivity{
+			FolderID:      f.ID,
+			ActorID:       folder.Owner,
+			ActorUsername: folder.OwnerUsername,
+			Kind:          ActivityPrivacyChanged,
+			Subject:       "private",
+		}); err != nil {
+			return err
+		}
+	}
+	folder.Private = true
+	return nil
+}
+
+// ExportFolder returns the folder with its items and, recursively, the
+// subfolders the user can view.
+func (fc *FolderController) ExportFolder(folderID int, userID int) (FolderExport, error) {
+	var folder model.Folder
+	if err := fc.DB.First(&folder, folderID).Error; err != nil {
+		return FolderExport{}, fmt.Errorf("folder not found: %w", err)
+	}
+	ok, err := canViewFolder(fc.DB, folder, userID)
+	if err != nil {
+		return FolderExport{}, err
+	}
+	if !ok {
+		return FolderExport{}, fmt.Errorf("user does not have permission to do that")
+	}
+	return fc.exportFolder(folder, userID, 0)
+}
+
+func (fc *FolderController) exportFolder(folder model.Folder, userID int, depth int) (FolderExport, error) {
+	if depth > maxFolderDepth {
+		return FolderExport{}, fmt.Errorf("folder is nested too deeply")
+	}
+	if err := fc.DB.Preload("Tags").
+		Preload("Items", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at ASC")
+		}).
+		First(&folder, folder.ID).Error; err != nil {
+		return FolderExport{}, err
+	}
+	export := FolderExport{
+		Name:       folder.Name,
+		Private:    folder.Private,
+		CoverURL:   folder.CoverURL,
+		Tags:       []string{},
+		CreatedAt:  folder.CreatedAt,
+		Items:      []ItemExport{},
+		Subfolders: []FolderExport{},
+	}
+	for _, tag := range folder.Tags {
+		export.Tags = append(export.Tags, tag.Name)
+	}
+	for _, item := range folder.Items {
+		export.Items = append(export.Items, ItemExport{Name: item.Name, URL: item.URL, Notes: item.Notes, CreatedAt: item.CreatedAt})
+	}
+	children, err := fc.GetSubfolders(int(folder.ID), userID)
+	if err != nil {
+		return FolderExport{}, err
+	}
+	for _, child := range children {
+		sub, err := fc.exportFolder(child, userID, depth+1)
+		if err != nil {
+			return FolderExport{}, err
+		}
+		export.Subfolders = append(export.Subfolders, sub)
+	}
+	return export, nil
+}
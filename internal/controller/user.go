@@ -1,72 +1,275 @@
 package controller
 
 import (
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 	"log"
 	"strings"
+	"time"
+	"twilu/internal/mail"
 	"twilu/internal/model"
 	"twilu/internal/util"
 )
 
+// DefaultProfilePicture is given to new accounts.
+const DefaultProfilePicture = "https://www.testhouse.net/wp-content/uploads/2021/11/default-avatar.jpg"
+
+// AccountDeletionGracePeriod is how long a user has to change their mind
+// after asking for their account to be deleted.
+const AccountDeletionGracePeriod = 14 * 24 * time.Hour
+
 // UserController handles operations on folders.
 type UserController struct {
-	DB *gorm.DB
+	DB             *gorm.DB
+	PasswordPolicy util.PasswordPolicy
+	Mailer         mail.Mailer
 }
 
 // NewUserController creates a new instance of UserController.
-func NewUserController(db *gorm.DB) *UserController {
-	return &UserController{DB: db}
+func NewUserController(db *gorm.DB, policy util.PasswordPolicy, mailer mail.Mailer) *UserController {
+	return &UserController{DB: db, PasswordPolicy: policy, Mailer: mailer}
+}
+
+// NormalizeIdentifier trims and lowercases a username or email so that sign
+// in and uniqueness checks do not depend on how it was typed.
+func NormalizeIdentifier(identifier string) string {
+	return strings.ToLower(strings.TrimSpace(identifier))
 }
 func (uc *UserController) CreateAccount(user model.User) error {
-	user.Username = strings.ToLower(user.Username)
+	user.Username = NormalizeIdentifier(user.Username)
+	user.Email = NormalizeIdentifier(user.Email)
 	password, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
 	user.Password = string(password)
-	if err := uc.DB.Create(&user).Error; err != nil {
+	return uc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		_, err := createInbox(tx, &user)
+		return err
+	})
+}
+
+// RequestDeletion schedules the account for deletion once the grace period
+// has passed. Signing back in before then allows the request to be cancelled.
+//
+// Only the session that made the request is signed out. The account's other
+// cookie sessions stay valid during the grace period, as they are how the
+// owner cancels the request; API tokens are refused from now on, see
+// TokenController.Authenticate.
+func (uc *UserController) RequestDeletion(id int) error {
+	var user model.User
+	if err := uc.DB.First(&user, id).Error; err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+	if user.DeletionRequestedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	if err := uc.DB.Model(&user).Update("deletion_requested_at", now).Error; err != nil {
 		return err
 	}
+	purgeAt := now.Add(AccountDeletionGracePeriod)
+	body := fmt.Sprintf("Hi @%s,\n\nYour Twilu account is scheduled for deletion on %s.\n"+
+		"If you change your mind, sign back in before then and cancel the deletion from your account page.\n",
+		user.Username, purgeAt.Format("January 2, 2006"))
+	if err := uc.Mailer.Send(user.Email, "Your Twilu account will be deleted", body); err != nil {
+		log.Println(err)
+	}
 	return nil
 }
-func (uc *UserController) DeleteAccount(id int) error {
-	if err := uc.DB.Unscoped().Exec("DELETE FROM user_folders WHERE folder_id IN (SELECT id FROM folders WHERE owner = ?)", id).Error; err != nil {
+func (uc *UserController) CancelDeletion(id int) error {
+	var user model.User
+	if err := uc.DB.First(&user, id).Error; err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+	if user.DeletionRequestedAt == nil {
+		return fmt.Errorf("account is not scheduled for deletion")
+	}
+	if time.Since(*user.DeletionRequestedAt) > AccountDeletionGracePeriod {
+		return fmt.Errorf("grace period has ended")
+	}
+	return uc.DB.Model(&user).Update("deletion_requested_at", nil).Error
+}
+
+// PurgeDeletedAccounts permanently removes every account whose grace period
+// has ended, along with its folders and items, and emails a confirmation. An
+// account that fails to purge is logged and retried on the next run, without
+// holding up the others.
+func (uc *UserController) PurgeDeletedAccounts() error {
+	var users []model.User
+	cutoff := time.Now().Add(-AccountDeletionGracePeriod)
+	if err := uc.DB.Where("deletion_requested_at <= ?", cutoff).Find(&users).Error; err != nil {
 		return err
 	}
+	for _, user := range users {
+		err := uc.DB.Transaction(func(tx *gorm.DB) error {
+			return purgeAccount(tx, user.ID)
+		})
+		if err != nil {
+			log.Printf("unable to purge user %d: %v", user.ID, err)
+			continue
+		}
+		body := fmt.Sprintf("Hi @%s,\n\nYour Twilu account and all of its folders and items have been permanently deleted.\n", user.Username)
+		if err := uc.Mailer.Send(user.Email, "Your Twilu account has been deleted", body); err != nil {
+			log.Println(err)
+		}
+	}
+	return nil
+}
 
-	if err := uc.DB.Unscoped().Exec("DELETE FROM folder_contributors WHERE folder_id IN (SELECT id FROM folders WHERE owner = ?)", id).Error; err != nil {
+func purgeAccount(tx *gorm.DB, id uint) error {
+	owned := tx.Unscoped().Model(&model.Folder{}).Select("id").Where("owner = ?", id)
+	if err := tx.Exec("DELETE FROM user_folders WHERE user_id = ? OR folder_id IN (?)", id, owned).Error; err != nil {
 		return err
 	}
-	if err := uc.DB.Unscoped().Where("owner_id = ?", id).Delete(&model.Item{}).Error; err != nil {
+	if err := tx.Exec("DELETE FROM folder_contributors WHERE user_id = ? OR folder_id IN (?)", id, owned).Error; err != nil {
 		return err
 	}
-
-	if err := uc.DB.Unscoped().Where("owner = ?", id).Delete(&model.Folder{}).Error; err != nil {
+	if err := tx.Exec("DELETE FROM folder_tags WHERE folder_id IN (?)", owned).Error; err != nil {
 		return err
 	}
-
-	if err := uc.DB.Unscoped().Where("id = ?", id).Delete(&model.User{}).Error; err != nil {
+	if err := tx.Where("folder_id IN (?) OR item_id IN (?)", owned, tx.Unscoped().Model(&model.Item{}).Select("id").Where("owner_id = ?", id)).Delete(&model.Comment{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ? OR item_id IN (?)", id, tx.Unscoped().Model(&model.Item{}).Select("id").Where("owner_id = ? OR folder_id IN (?)", id, owned)).Delete(&model.ItemState{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("owner_id = ? OR folder_id IN (?)", id, owned).Delete(&model.Item{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("user_id = ?", id).Delete(&model.APIToken{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("user_id = ?", id).Delete(&model.Identity{}).Error; err != nil {
+		return err
+	}
+	// What the user did in other people's folders stays in those folders'
+	// audit logs, without saying who did it.
+	if err := tx.Model(&model.AuditEvent{}).Where("folder_id IS NOT NULL AND folder_id NOT IN (?)", owned).
+		Where("actor_id = ?", id).
+		Updates(map[string]interface{}{"actor_id": 0, "actor_username": "", "ip": ""}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&model.AuditEvent{}).Where("folder_id IS NOT NULL AND folder_id NOT IN (?)", owned).
+		Where("subject_user_id = ?", id).
+		Update("subject_user_id", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("actor_id = ? OR subject_user_id = ? OR folder_id IN (?)", id, id, owned).Delete(&model.AuditEvent{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("folder_id IN (?)", owned).Delete(&model.FolderActivity{}).Error; err != nil {
 		return err
 	}
+	if err := tx.Where("follower_id = ? OR followee_id = ?", id, id).Delete(&model.Follow{}).Error; err != nil {
+		return err
+	}
+	// Likes and saves of other users' folders are taken back so their counts
+	// stay right.
+	if err := tx.Exec("UPDATE folders SET like_count = like_count - 1 WHERE id IN (SELECT folder_id FROM folder_likes WHERE user_id = ?)", id).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec("UPDATE folders SET save_count = save_count - 1 WHERE id IN (SELECT folder_id FROM saved_folders WHERE user_id = ?)", id).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ? OR folder_id IN (?)", id, owned).Delete(&model.FolderLike{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ? OR folder_id IN (?)", id, owned).Delete(&model.SavedFolder{}).Error; err != nil {
+		return err
+	}
+	// Comments on other users' folders are blanked rather than deleted so
+	// that replies to them keep their place.
+	if err := tx.Model(&model.Comment{}).Where("author_id = ?", id).Updates(map[string]interface{}{"body": "", "removed": true, "author_username": ""}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ? OR folder_id IN (?)", id, owned).Delete(&model.Notification{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", id).Delete(&model.NotificationPreference{}).Error; err != nil {
+		return err
+	}
+	webhooks := tx.Model(&model.Webhook{}).Select("id").Where("folder_id IN (?)", owned)
+	if err := tx.Where("webhook_id IN (?)", webhooks).Delete(&model.WebhookDelivery{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("folder_id IN (?)", owned).Delete(&model.Webhook{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("folder_id IN (?)", owned).Delete(&model.FeedSubscription{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&model.User{}).Where("default_folder_id IN (?)", owned).Update("default_folder_id", nil).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("owner_id = ?", id).Delete(&model.SmartFolder{}).Error; err != nil {
+		return err
+	}
+	// The folders go last, as the deletes above find the user's folders
+	// through them.
+	if err := tx.Unscoped().Where("owner = ?", id).Delete(&model.Folder{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("id = ?", id).Delete(&model.User{}).Error; err != nil {
+		return err
+	}
+	return nil
+}
 
+// checkNotPurged rejects accounts whose grace period has ended but which the
+// purge job has not removed yet.
+func checkNotPurged(user model.User) error {
+	if user.DeletionRequestedAt != nil && time.Since(*user.DeletionRequestedAt) > AccountDeletionGracePeriod {
+		return fmt.Errorf("account has been deleted")
+	}
 	return nil
 }
 
-func (uc *UserController) SignIn(user model.User) (model.User, error) {
-	var userLookUp model.User
-	err := uc.DB.Preload("Folders").Find(&userLookUp, "username = ?", user.Username).Error
+// SignIn checks the password of the account matching identifier, which may
+// be either its username or its email.
+func (uc *UserController) SignIn(identifier string, password string) (model.User, error) {
+	exact := strings.TrimSpace(identifier)
+	identifier = NormalizeIdentifier(identifier)
+	column := "username"
+	if strings.Contains(identifier, "@") {
+		column = "email"
+	}
+	userLookUp, err := uc.checkPassword(column, identifier, password)
+	// Accounts that could not be lowercased because another account had the
+	// same name in a different case keep signing in with their exact case.
+	if err != nil && exact != identifier {
+		if legacy, legacyErr := uc.checkPassword(column, exact, password); legacyErr == nil {
+			userLookUp, err = legacy, nil
+		}
+	}
 	if err != nil {
 		return model.User{}, err
 	}
-	err2 := bcrypt.CompareHashAndPassword([]byte(userLookUp.Password), []byte(user.Password))
-	if err2 != nil {
-		return model.User{}, err2
+	if err := checkNotPurged(userLookUp); err != nil {
+		return model.User{}, err
 	}
 	return userLookUp, nil
 }
+
+// checkPassword returns the account whose column matches value exactly, if
+// password is its password.
+func (uc *UserController) checkPassword(column string, value string, password string) (model.User, error) {
+	var user model.User
+	if err := uc.DB.Preload("Folders").Where(column+" = ?", value).First(&user).Error; err != nil {
+		return model.User{}, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
 func (uc *UserController) GetUserByID(userID int) (model.User, error) {
 	var user model.User
 	if err := uc.DB.First(&user, userID).Error; err != nil {
@@ -74,9 +277,12 @@ func (uc *UserController) GetUserByID(userID int) (model.User, error) {
 	}
 	return user, nil
 }
+
+// GetUserFoldersByID returns the user's top-level folders. Subfolders are
+// reached through their parents.
 func (uc *UserController) GetUserFoldersByID(userID int) ([]model.Folder, error) {
 	var folders []model.Folder
-	if err := uc.DB.Model(&model.Folder{}).Where("owner = ?", userID).Order("created_at DESC").Find(&folders).Error; err != nil {
+	if err := uc.DB.Model(&model.Folder{}).Where("owner = ? AND parent_id IS NULL", userID).Order("created_at DESC").Find(&folders).Error; err != nil {
 		return []model.Folder{}, err
 	}
 	return folders, nil
@@ -86,8 +292,8 @@ func (uc *UserController) UpdatePassword(userID int, currentPw string, newPw str
 	if err := uc.DB.First(&user, userID).Error; err != nil {
 		return err
 	}
-	if util.PasswordIsValid(newPw) == false {
-		return fmt.Errorf("invalid password")
+	if err := uc.PasswordPolicy.Validate(newPw); err != nil {
+		return err
 	}
 	if newPw == currentPw {
 		return fmt.Errorf("new password can't be the same as the old one")
@@ -106,3 +312,234 @@ func (uc *UserController) UpdatePassword(userID int, currentPw string, newPw str
 	}
 	return nil
 }
+
+func (uc *UserController) GetUserByUsername(username string) (model.User, error) {
+	var user model.User
+	if err := uc.DB.Where("username = ?", NormalizeIdentifier(username)).First(&user).Error; err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+func (uc *UserController) Follow(followerID int, username string) (model.User, error) {
+	followee, err := uc.GetUserByUsername(username)
+	if err != nil {
+		return model.User{}, fmt.Errorf("user not found: %w", err)
+	}
+	if followee.ID == uint(followerID) {
+		return model.User{}, fmt.Errorf("users can't follow themselves")
+	}
+	follow := model.Follow{FollowerID: uint(followerID), FolloweeID: followee.ID}
+	if err := uc.DB.Where(follow).FirstOrCreate(&follow).Error; err != nil {
+		return model.User{}, fmt.Errorf("unable to follow user: %w", err)
+	}
+	return followee, nil
+}
+func (uc *UserController) Unfollow(followerID int, username string) (model.User, error) {
+	followee, err := uc.GetUserByUsername(username)
+	if err != nil {
+		return model.User{}, fmt.Errorf("user not found: %w", err)
+	}
+	if err := uc.DB.Where("follower_id = ? AND followee_id = ?", followerID, followee.ID).Delete(&model.Follow{}).Error; err != nil {
+		return model.User{}, fmt.Errorf("unable to unfollow user: %w", err)
+	}
+	return followee, nil
+}
+func (uc *UserController) IsFollowing(followerID int, followeeID uint) (bool, error) {
+	var count int64
+	if err := uc.DB.Model(&model.Follow{}).Where("follower_id = ? AND followee_id = ?", followerID, followeeID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetFollowCounts returns how many users follow the user and how many they follow.
+func (uc *UserController) GetFollowCounts(userID uint) (followers int64, following int64, err error) {
+	if err := uc.DB.Model(&model.Follow{}).Where("followee_id = ?", userID).Count(&followers).Error; err != nil {
+		return 0, 0, err
+	}
+	if err := uc.DB.Model(&model.Follow{}).Where("follower_id = ?", userID).Count(&following).Error; err != nil {
+		return 0, 0, err
+	}
+	return followers, following, nil
+}
+
+// Profile is the public view of a user.
+type Profile struct {
+	Username       string
+	ProfilePicture string
+	JoinedAt       time.Time
+	Folders        []model.Folder
+	FolderCount    int64
+	ItemCount      int64
+	Followers      int64
+	Following      int64
+}
+
+// GetProfile returns the public profile of a user. Private folders are left
+// out, and accounts pending deletion are treated as not found.
+func (uc *UserController) GetProfile(username string) (Profile, error) {
+	user, err := uc.GetUserByUsername(username)
+	if err != nil {
+		return Profile{}, fmt.Errorf("user not found: %w", err)
+	}
+	if user.DeletionRequestedAt != nil {
+		return Profile{}, fmt.Errorf("user not found: %w", gorm.ErrRecordNotFound)
+	}
+	profile := Profile{
+		Username:       user.Username,
+		ProfilePicture: user.ProfilePicture,
+		JoinedAt:       user.CreatedAt,
+	}
+	if err := uc.DB.Where("owner = ? AND private = ?", user.ID, false).
+		Order("created_at DESC").
+		Find(&profile.Folders).Error; err != nil {
+		return Profile{}, err
+	}
+	profile.FolderCount = int64(len(profile.Folders))
+	if err := uc.DB.Model(&model.Item{}).
+		Joins("JOIN folders ON folders.id = items.folder_id AND folders.deleted_at IS NULL").
+		Where("folders.owner = ? AND folders.private = ?", user.ID, false).
+		Count(&profile.ItemCount).Error; err != nil {
+		return Profile{}, err
+	}
+	if profile.Followers, profile.Following, err = uc.GetFollowCounts(user.ID); err != nil {
+		return Profile{}, err
+	}
+	return profile, nil
+}
+
+// ExternalIdentity is a user as asserted by a single sign-on provider.
+type ExternalIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Picture       string
+}
+
+// SignInExternal returns the account linked to the external identity. An
+// unlinked identity is attached to the account with the same verified email,
+// otherwise a new account is provisioned for it if the email is verified.
+func (uc *UserController) SignInExternal(ext ExternalIdentity) (model.User, error) {
+	var user model.User
+	err := uc.DB.Transaction(func(tx *gorm.DB) error {
+		var identity model.Identity
+		err := tx.Where("issuer = ? AND subject = ?", ext.Issuer, ext.Subject).First(&identity).Error
+		if err == nil {
+			if err := tx.First(&user, identity.UserID).Error; err != nil {
+				return err
+			}
+			return checkNotPurged(user)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		email := NormalizeIdentifier(ext.Email)
+		if email == "" {
+			return fmt.Errorf("identity provider did not return an email")
+		}
+		err = tx.Where("email = ?", email).First(&user).Error
+		switch {
+		case err == nil:
+			if !ext.EmailVerified {
+				return fmt.Errorf("email %s is already registered, sign in with your password", email)
+			}
+			if err := checkNotPurged(user); err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// An unverified address could belong to someone else, who would
+			// then be unable to sign up with it.
+			if !ext.EmailVerified {
+				return fmt.Errorf("email %s has not been verified by the identity provider", email)
+			}
+			if user, err = provisionExternalUser(tx, ext, email); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		identity = model.Identity{UserID: user.ID, Issuer: ext.Issuer, Subject: ext.Subject}
+		if err := tx.Create(&identity).Error; err != nil {
+			return fmt.Errorf("failed to link identity: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+// provisionExternalUser creates an account for a first-time SSO user. The
+// password is random, so the account can only be used through SSO.
+func provisionExternalUser(tx *gorm.DB, ext ExternalIdentity, email string) (model.User, error) {
+	username, err := availableUsername(tx, ext.Username, email)
+	if err != nil {
+		return model.User{}, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return model.User{}, err
+	}
+	password, err := bcrypt.GenerateFromPassword(secret, bcrypt.DefaultCost)
+	if err != nil {
+		return model.User{}, err
+	}
+	user := model.User{
+		Email:          email,
+		Username:       username,
+		Password:       string(password),
+		ProfilePicture: ext.Picture,
+	}
+	if user.ProfilePicture == "" {
+		user.ProfilePicture = DefaultProfilePicture
+	}
+	if err := tx.Create(&user).Error; err != nil {
+		return model.User{}, fmt.Errorf("failed to create user: %w", err)
+	}
+	if _, err := createInbox(tx, &user); err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+// availableUsername derives a username from the preferred name or the email
+// local part, appending a number until it no longer collides.
+func availableUsername(tx *gorm.DB, preferred string, email string) (string, error) {
+	base := sanitizeUsername(preferred)
+	if len(base) < 3 {
+		local, _, _ := strings.Cut(email, "@")
+		base = sanitizeUsername(local)
+	}
+	if len(base) < 3 {
+		base = "user"
+	}
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s%d", base, i)
+		}
+		var count int64
+		if err := tx.Model(&model.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("unable to find a free username for %s", base)
+}
+
+func sanitizeUsername(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '.' || r == '-' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"testing"
+	"twilu/internal/model"
+)
+
+func TestSignInExternalLinksExistingEmail(t *testing.T) {
+	db := testDB(t)
+	uc := &UserController{DB: db}
+	existing := model.User{Email: "someone@example.com", Username: "someone", Password: "x"}
+	if err := db.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	ext := ExternalIdentity{Issuer: "https://issuer.example", Subject: "user-1", Email: "Someone@Example.com", EmailVerified: true}
+	user, err := uc.SignInExternal(ext)
+	if err != nil {
+		t.Fatalf("SignInExternal() error = %v", err)
+	}
+	if user.ID != existing.ID {
+		t.Fatalf("SignInExternal() signed in as user %d, want the existing user %d", user.ID, existing.ID)
+	}
+	var identities int64
+	db.Model(&model.Identity{}).Where("user_id = ? AND issuer = ? AND subject = ?", existing.ID, ext.Issuer, ext.Subject).Count(&identities)
+	if identities != 1 {
+		t.Fatalf("found %d linked identities, want 1", identities)
+	}
+
+	// Once linked, the identity signs in even if the email changes upstream.
+	ext.Email = "renamed@example.com"
+	if user, err = uc.SignInExternal(ext); err != nil || user.ID != existing.ID {
+		t.Fatalf("SignInExternal() = %d, %v, want the linked user %d", user.ID, err, existing.ID)
+	}
+}
+
+func TestSignInExternalRefusesUnverifiedEmail(t *testing.T) {
+	db := testDB(t)
+	uc := &UserController{DB: db}
+	existing := model.User{Email: "someone@example.com", Username: "someone", Password: "x"}
+	if err := db.Create(&existing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	ext := ExternalIdentity{Issuer: "https://issuer.example", Subject: "user-2", Email: "someone@example.com"}
+	if _, err := uc.SignInExternal(ext); err == nil {
+		t.Fatal("SignInExternal() linked an unverified email to an existing account")
+	}
+
+	ext = ExternalIdentity{Issuer: "https://issuer.example", Subject: "user-3", Email: "nobody@example.com"}
+	if _, err := uc.SignInExternal(ext); err == nil {
+		t.Fatal("SignInExternal() created an account for an unverified email")
+	}
+	var count int64
+	db.Model(&model.User{}).Where("email = ?", "nobody@example.com").Count(&count)
+	if count != 0 {
+		t.Fatalf("SignInExternal() left %d accounts with the unverified email", count)
+	}
+}
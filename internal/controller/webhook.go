@@ -0,0 +1,298 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"twilu/internal/model"
+	"twilu/internal/netguard"
+)
+
+// Events sent to webhooks.
+const (
+	WebhookItemCreated   = "item.created"
+	WebhookItemDeleted   = "item.deleted"
+	WebhookFolderUpdated = "folder.updated"
+	WebhookPing          = "ping"
+)
+
+// Statuses of a webhook delivery.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+const (
+	// maxWebhookAttempts is how many times a delivery is tried before it is
+	// given up on.
+	maxWebhookAttempts = 8
+	// webhookBackoff is the wait before the first retry. It doubles with
+	// every further attempt.
+	webhookBackoff = time.Minute
+	// webhookDeliveryBatch caps how many deliveries one run of the queue sends.
+	webhookDeliveryBatch = 50
+	// webhookLogSize caps how many deliveries are shown in a webhook's log.
+	webhookLogSize = 20
+)
+
+// WebhookController handles a folder's webhooks and delivers their events.
+type WebhookController struct {
+	DB     *gorm.DB
+	Client *http.Client
+}
+
+// NewWebhookController creates a new instance of WebhookController. Its
+// client refuses to connect to internal addresses, so webhooks can't be used
+// to probe the server's network.
+func NewWebhookController(db *gorm.DB) *WebhookController {
+	return &WebhookController{DB: db, Client: netguard.NewClient(10 * time.Second)}
+}
+
+// webhookPayload is the JSON body posted to a webhook.
+type webhookPayload struct {
+	Event    string        `json:"event"`
+	SentAt   time.Time     `json:"sent_at"`
+	FolderID uint          `json:"folder_id"`
+	Folder   *model.Folder `json:"folder,omitempty"`
+	Item     *model.Item   `json:"item,omitempty"`
+}
+
+// enqueueWebhooks queues event for every webhook of the folder. It runs inside
+// the transaction of the change so that only committed changes are sent.
+func enqueueWebhooks(tx *gorm.DB, folderID uint, event string, folder *model.Folder, item *model.Item) error {
+	var webhooks []model.Webhook
+	if err := tx.Where("folder_id = ?", folderID).Find(&webhooks).Error; err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(webhookPayload{Event: event, SentAt: time.Now(), FolderID: folderID, Folder: folder, Item: item})
+	if err != nil {
+		return fmt.Errorf("unable to encode webhook payload: %w", err)
+	}
+	now := time.Now()
+	for _, webhook := range webhooks {
+		delivery := model.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			Event:         event,
+			Payload:       string(payload),
+			Status:        DeliveryPending,
+			NextAttemptAt: &now,
+		}
+		if err := tx.Create(&delivery).Error; err != nil {
+			return fmt.Errorf("unable to queue webhook: %w", err)
+		}
+	}
+	return nil
+}
+
+// ownedFolder returns the folder if the user owns it.
+func ownedFolder(tx *gorm.DB, folderID uint, userID int) (model.Folder, error) {
+	var folder model.Folder
+	if err := tx.First(&folder, folderID).Error; err != nil {
+		return model.Folder{}, fmt.Errorf("folder not found: %w", err)
+	}
+	if folder.Owner != uint(userID) {
+		return model.Folder{}, fmt.Errorf("user is not the owner")
+	}
+	return folder, nil
+}
+
+// ownedWebhook returns the webhook if the user owns its folder.
+func (wc *WebhookController) ownedWebhook(tx *gorm.DB, webhookID int, userID int) (model.Webhook, error) {
+	var webhook model.Webhook
+	if err := tx.First(&webhook, webhookID).Error; err != nil {
+		return model.Webhook{}, fmt.Errorf("webhook not found: %w", err)
+	}
+	if _, err := ownedFolder(tx, webhook.FolderID, userID); err != nil {
+		return model.Webhook{}, err
+	}
+	return webhook, nil
+}
+func (wc *WebhookController) GetWebhooks(folderID int, userID int) ([]model.Webhook, error) {
+	if _, err := ownedFolder(wc.DB, uint(folderID), userID); err != nil {
+		return []model.Webhook{}, err
+	}
+	var webhooks []model.Webhook
+	if err := wc.DB.Where("folder_id = ?", folderID).Order("created_at DESC").Find(&webhooks).Error; err != nil {
+		return []model.Webhook{}, err
+	}
+	return webhooks, nil
+}
+
+// CreateWebhook adds a webhook to one of the user's folders and returns it
+// with its signing secret.
+func (wc *WebhookController) CreateWebhook(folderID int, userID int, target string) (model.Webhook, error) {
+	parsed, err := url.Parse(target)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return model.Webhook{}, fmt.Errorf("webhook URL must be an http or https URL")
+	}
+	folder, err := ownedFolder(wc.DB, uint(folderID), userID)
+	if err != nil {
+		return model.Webhook{}, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return model.Webhook{}, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	webhook := model.Webhook{FolderID: folder.ID, URL: parsed.String(), Secret: hex.EncodeToString(secret)}
+	if err := wc.DB.Create(&webhook).Error; err != nil {
+		return model.Webhook{}, fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return webhook, nil
+}
+func (wc *WebhookController) DeleteWebhook(webhookID int, userID int) (model.Webhook, error) {
+	var webhook model.Webhook
+	err := wc.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if webhook, err = wc.ownedWebhook(tx, webhookID, userID); err != nil {
+			return err
+		}
+		if err := tx.Where("webhook_id = ?", webhook.ID).Delete(&model.WebhookDelivery{}).Error; err != nil {
+			return fmt.Errorf("unable to delete deliveries: %w", err)
+		}
+		return tx.Delete(&webhook).Error
+	})
+	if err != nil {
+		return model.Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// Ping queues a test event for the webhook.
+func (wc *WebhookController) Ping(webhookID int, userID int) (model.Webhook, error) {
+	var webhook model.Webhook
+	err := wc.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if webhook, err = wc.ownedWebhook(tx, webhookID, userID); err != nil {
+			return err
+		}
+		payload, err := json.Marshal(webhookPayload{Event: WebhookPing, SentAt: time.Now(), FolderID: webhook.FolderID})
+		if err != nil {
+			return fmt.Errorf("unable to encode webhook payload: %w", err)
+		}
+		now := time.Now()
+		return tx.Create(&model.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			Event:         WebhookPing,
+			Payload:       string(payload),
+			Status:        DeliveryPending,
+			NextAttemptAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return model.Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// GetDeliveries returns the most recent deliveries of the webhook.
+func (wc *WebhookController) GetDeliveries(webhookID int, userID int) (model.Webhook, []model.WebhookDelivery, error) {
+	webhook, err := wc.ownedWebhook(wc.DB, webhookID, userID)
+	if err != nil {
+		return model.Webhook{}, []model.WebhookDelivery{}, err
+	}
+	var deliveries []model.WebhookDelivery
+	if err := wc.DB.Where("webhook_id = ?", webhook.ID).
+		Order("created_at DESC").
+		Limit(webhookLogSize).
+		Find(&deliveries).Error; err != nil {
+		return model.Webhook{}, []model.WebhookDelivery{}, err
+	}
+	return webhook, deliveries, nil
+}
+
+// DeliverPending sends the deliveries that are due. Failed attempts are
+// retried with exponential backoff until maxWebhookAttempts is reached. A
+// delivery that can't be sent or recorded is logged and the rest of the batch
+// goes ahead.
+func (wc *WebhookController) DeliverPending() error {
+	var deliveries []model.WebhookDelivery
+	if err := wc.DB.Where("status = ? AND next_attempt_at <= ?", DeliveryPending, time.Now()).
+		Order("next_attempt_at ASC").
+		Limit(webhookDeliveryBatch).
+		Find(&deliveries).Error; err != nil {
+		return err
+	}
+	for _, delivery := range deliveries {
+		var webhook model.Webhook
+		if err := wc.DB.First(&webhook, delivery.WebhookID).Error; err != nil {
+			log.Printf("webhook of delivery %d not found: %v", delivery.ID, err)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				if err := wc.DB.Model(&delivery).Updates(map[string]interface{}{"status": DeliveryFailed, "next_attempt_at": nil}).Error; err != nil {
+					log.Printf("unable to record delivery %d: %v", delivery.ID, err)
+				}
+			}
+			continue
+		}
+		status, err := wc.send(webhook, delivery)
+
+		delivery.Attempts++
+		delivery.LastStatus = status
+		delivery.LastError = ""
+		if err != nil {
+			delivery.LastError = err.Error()
+		}
+		switch {
+		case err == nil:
+			delivery.Status = DeliveryDelivered
+			delivery.NextAttemptAt = nil
+		case delivery.Attempts >= maxWebhookAttempts:
+			delivery.Status = DeliveryFailed
+			delivery.NextAttemptAt = nil
+		default:
+			next := time.Now().Add(webhookBackoff << (delivery.Attempts - 1))
+			delivery.NextAttemptAt = &next
+		}
+		if err := wc.DB.Select("Attempts", "LastStatus", "LastError", "Status", "NextAttemptAt").Save(&delivery).Error; err != nil {
+			log.Printf("unable to record delivery %d: %v", delivery.ID, err)
+		}
+	}
+	return nil
+}
+
+// send posts the delivery's payload, signed with the webhook's secret, and
+// returns the response status.
+func (wc *WebhookController) send(webhook model.Webhook, delivery model.WebhookDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Twilu-Webhooks")
+	req.Header.Set("X-Twilu-Event", delivery.Event)
+	req.Header.Set("X-Twilu-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Twilu-Signature", "sha256="+SignWebhook(webhook.Secret, []byte(delivery.Payload)))
+	resp, err := wc.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhook returns the hex encoded HMAC-SHA256 of payload under secret, as
+// sent in the X-Twilu-Signature header.
+func SignWebhook(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
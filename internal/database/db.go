@@ -15,7 +15,13 @@ func New() (*gorm.DB, error) {
 	}
 
 	// AutoMigrate your models here
-	if err := db.AutoMigrate(&model.User{}, &model.Folder{}, &model.Item{}); err != nil {
+	if err := db.AutoMigrate(&model.User{}, &model.Folder{}, &model.Item{}, &model.APIToken{}, &model.Identity{}, &model.AuditEvent{}, &model.FolderActivity{}, &model.Follow{}, &model.Tag{}, &model.FolderLike{}, &model.SavedFolder{}, &model.Comment{}, &model.Notification{}, &model.NotificationPreference{}, &model.Webhook{}, &model.WebhookDelivery{}, &model.FeedSubscription{}, &model.SmartFolder{}, &model.ItemState{}); err != nil {
+		return nil, err
+	}
+	if err := normalizeUserIdentifiers(db); err != nil {
+		return nil, err
+	}
+	if err := uniqueInboxes(db); err != nil {
 		return nil, err
 	}
 
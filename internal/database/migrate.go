@@ -0,0 +1,68 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"log"
+	"strings"
+	"twilu/internal/model"
+)
+
+// normalizeUserIdentifiers lowercases usernames and emails stored before sign
+// in became case-insensitive. Rows are handled oldest first, so when several
+// accounts differ only in case the oldest one gets the lowercased value,
+// unless another account already had it. The rows that lose are left as they
+// are and logged so they can be resolved by hand; until then they sign in with
+// their exact case.
+func normalizeUserIdentifiers(db *gorm.DB) error {
+	for _, column := range []string{"username", "email"} {
+		var users []model.User
+		if err := db.Unscoped().
+			Where(column + " <> LOWER(TRIM(" + column + "))").
+			Order("id ASC").
+			Find(&users).Error; err != nil {
+			return err
+		}
+		for _, user := range users {
+			current := user.Username
+			if column == "email" {
+				current = user.Email
+			}
+			normalized := strings.ToLower(strings.TrimSpace(current))
+
+			var taken int64
+			if err := db.Unscoped().Model(&model.User{}).
+				Where(column+" = ? AND id <> ?", normalized, user.ID).
+				Count(&taken).Error; err != nil {
+				return err
+			}
+			if taken > 0 {
+				log.Printf("unable to lowercase %s of user %d: %q collides with another account", column, user.ID, current)
+				continue
+			}
+			if err := db.Unscoped().Model(&user).UpdateColumn(column, normalized).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// uniqueInboxes makes sure no account ends up with two inboxes when its first
+// one is created by two requests at once. Accounts that already have several
+// are logged so they can be merged by hand, and the index is left out until
+// they are.
+func uniqueInboxes(db *gorm.DB) error {
+	var owners []uint
+	if err := db.Model(&model.Folder{}).
+		Where("inbox = ?", true).
+		Group("owner").
+		Having("COUNT(*) > 1").
+		Pluck("owner", &owners).Error; err != nil {
+		return err
+	}
+	if len(owners) > 0 {
+		log.Printf("unable to enforce one inbox per account: users %v have several", owners)
+		return nil
+	}
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_folders_inbox ON folders (owner) WHERE inbox AND deleted_at IS NULL").Error
+}
@@ -0,0 +1,200 @@
+package feed
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// rssInput and atomInput are the parts of RSS 2.0 and Atom documents that
+// Parse reads. Elements are matched by local name, so namespace prefixes
+// don't matter.
+type rssInput struct {
+	Channel struct {
+		Title string `xml:"title"`
+		Items []struct {
+			Title   string `xml:"title"`
+			Link    string `xml:"link"`
+			GUID    string `xml:"guid"`
+			PubDate string `xml:"pubDate"`
+			Date    string `xml:"date"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+type atomInput struct {
+	Title   string `xml:"title"`
+	Entries []struct {
+		ID        string `xml:"id"`
+		Title     string `xml:"title"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+		Links     []struct {
+			Rel  string `xml:"rel,attr"`
+			Href string `xml:"href,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+// Parse reads an RSS 2.0 or Atom document. Entries without an ID fall back to
+// their URL, and entries with neither are skipped. Published is zero when the
+// entry's date is missing or unreadable.
+func Parse(r io.Reader) (Feed, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Feed{}, fmt.Errorf("unable to read feed: %w", err)
+	}
+	root, err := rootElement(data)
+	if err != nil {
+		return Feed{}, fmt.Errorf("unable to read feed: %w", err)
+	}
+
+	var f Feed
+	switch root {
+	case "rss":
+		var in rssInput
+		if err := newDecoder(data).Decode(&in); err != nil {
+			return Feed{}, fmt.Errorf("unable to read RSS feed: %w", err)
+		}
+		f.Title = strings.TrimSpace(in.Channel.Title)
+		for _, item := range in.Channel.Items {
+			e := Entry{
+				ID:    strings.TrimSpace(item.GUID),
+				Title: strings.TrimSpace(item.Title),
+				URL:   strings.TrimSpace(item.Link),
+			}
+			if item.PubDate != "" {
+				e.Published = parseDate(item.PubDate)
+			} else {
+				e.Published = parseDate(item.Date)
+			}
+			f.Entries = appendEntry(f.Entries, e)
+		}
+	case "feed":
+		var in atomInput
+		if err := newDecoder(data).Decode(&in); err != nil {
+			return Feed{}, fmt.Errorf("unable to read Atom feed: %w", err)
+		}
+		f.Title = strings.TrimSpace(in.Title)
+		for _, entry := range in.Entries {
+			e := Entry{
+				ID:    strings.TrimSpace(entry.ID),
+				Title: strings.TrimSpace(entry.Title),
+			}
+			for _, link := range entry.Links {
+				if link.Rel == "" || link.Rel == "alternate" {
+					e.URL = strings.TrimSpace(link.Href)
+					break
+				}
+			}
+			if e.URL == "" && len(entry.Links) > 0 {
+				e.URL = strings.TrimSpace(entry.Links[0].Href)
+			}
+			if entry.Published != "" {
+				e.Published = parseDate(entry.Published)
+			} else {
+				e.Published = parseDate(entry.Updated)
+			}
+			f.Entries = appendEntry(f.Entries, e)
+		}
+	default:
+		return Feed{}, fmt.Errorf("not an RSS or Atom feed: <%s>", root)
+	}
+	return f, nil
+}
+
+// rootElement returns the local name of the document's root element.
+func rootElement(data []byte) (string, error) {
+	dec := newDecoder(data)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+func newDecoder(data []byte) *xml.Decoder {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = charsetReader
+	return dec
+}
+
+func appendEntry(entries []Entry, e Entry) []Entry {
+	if e.ID == "" {
+		e.ID = e.URL
+	}
+	if e.ID == "" {
+		return entries
+	}
+	if e.Title == "" {
+		e.Title = e.URL
+	}
+	return append(entries, e)
+}
+
+// dateLayouts are the date formats seen in feeds. RSS is meant to use RFC 822
+// dates and Atom RFC 3339, but both are often written loosely.
+var dateLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC822Z,
+	time.RFC822,
+	"2006-01-02T15:04:05",
+	time.DateOnly,
+}
+
+func parseDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// charsetReader lets Parse read feeds that declare Latin-1 or ASCII besides
+// UTF-8, which covers nearly all feeds that aren't UTF-8.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "latin1", "latin-1", "windows-1252":
+		return latin1Reader{bufio.NewReader(input)}, nil
+	}
+	return nil, fmt.Errorf("unsupported charset %q", charset)
+}
+
+// latin1Reader converts ISO-8859-1 to UTF-8. Windows-1252 is read the same
+// way, which only gets its few punctuation marks in 0x80-0x9f wrong.
+type latin1Reader struct {
+	r *bufio.Reader
+}
+
+func (l latin1Reader) Read(p []byte) (int, error) {
+	n := 0
+	for n+utf8.UTFMax <= len(p) {
+		b, err := l.r.ReadByte()
+		if err != nil {
+			if n > 0 && err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		n += utf8.EncodeRune(p[n:], rune(b))
+	}
+	return n, nil
+}
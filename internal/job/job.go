@@ -0,0 +1,22 @@
+// Package job runs periodic background work inside the server process.
+package job
+
+import (
+	"log"
+	"time"
+)
+
+// Every runs fn immediately and then once per interval on its own goroutine.
+// Errors are logged and do not stop later runs.
+func Every(name string, interval time.Duration, fn func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := fn(); err != nil {
+				log.Printf("job %s: %v", name, err)
+			}
+			<-ticker.C
+		}
+	}()
+}
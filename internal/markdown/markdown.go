@@ -0,0 +1,354 @@
+// Package markdown renders the Markdown written in item notes as HTML that is
+// safe to show on a page.
+//
+// Only a small, common subset is understood: paragraphs, headings, emphasis,
+// strikethrough, inline and fenced code, links, bare URLs, lists, block quotes
+// and rules. Raw HTML is never passed through; it is escaped like any other
+// text.
+package markdown
+
+import (
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxQuoteDepth caps how deeply block quotes nest. Anything deeper is
+	// shown as text.
+	maxQuoteDepth = 8
+	// maxInlineDepth caps how deeply emphasis and links nest, which keeps
+	// rendering a line linear in its length.
+	maxInlineDepth = 8
+	// maxLinkLength caps how far a link's URL is looked for.
+	maxLinkLength = 2048
+)
+
+// delimiters lists the emphasis delimiters, doubles first.
+var delimiters = []string{"**", "__", "~~", "*", "_"}
+
+var (
+	headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	bulletPattern  = regexp.MustCompile(`^\s{0,3}[-*+]\s+(.*)$`)
+	orderedPattern = regexp.MustCompile(`^\s{0,3}[0-9]{1,9}[.)]\s+(.*)$`)
+	rulePattern    = regexp.MustCompile(`^\s{0,3}((-[ \t]*){3,}|(\*[ \t]*){3,}|(_[ \t]*){3,})$`)
+	fencePattern   = regexp.MustCompile("^\\s{0,3}(```|~~~)")
+	quotePattern   = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+)
+
+// Render converts src to HTML. Links are kept only when they point at http,
+// https or mailto URLs; any other link is shown as its text. Single line
+// breaks are kept, as notes are usually written like messages rather than
+// documents.
+func Render(src string) template.HTML {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	var b strings.Builder
+	renderBlocks(&b, strings.Split(src, "\n"), 0)
+	return template.HTML(b.String())
+}
+
+func renderBlocks(b *strings.Builder, lines []string, depth int) {
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		b.WriteString("<p>")
+		b.WriteString(renderInline(strings.Join(paragraph, "\n"), true, 0))
+		b.WriteString("</p>\n")
+		paragraph = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case fencePattern.MatchString(line):
+			flush()
+			fence := fencePattern.FindStringSubmatch(line)[1]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString("<pre><code>")
+			b.WriteString(html.EscapeString(strings.Join(code, "\n")))
+			b.WriteString("</code></pre>\n")
+		case headingPattern.MatchString(line):
+			flush()
+			m := headingPattern.FindStringSubmatch(line)
+			level := string(rune('0' + len(m[1])))
+			b.WriteString("<h" + level + ">")
+			b.WriteString(renderInline(m[2], true, 0))
+			b.WriteString("</h" + level + ">\n")
+		case rulePattern.MatchString(line):
+			flush()
+			b.WriteString("<hr>\n")
+		case quotePattern.MatchString(line) && depth < maxQuoteDepth:
+			flush()
+			var quoted []string
+			for ; i < len(lines) && quotePattern.MatchString(lines[i]); i++ {
+				quoted = append(quoted, quotePattern.FindStringSubmatch(lines[i])[1])
+			}
+			i--
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, quoted, depth+1)
+			b.WriteString("</blockquote>\n")
+		case bulletPattern.MatchString(line):
+			flush()
+			i = renderList(b, lines, i, bulletPattern, "ul")
+		case orderedPattern.MatchString(line):
+			flush()
+			i = renderList(b, lines, i, orderedPattern, "ol")
+		default:
+			paragraph = append(paragraph, line)
+		}
+	}
+	flush()
+}
+
+// renderList writes the list starting at lines[start] and returns the index
+// of its last line. Indented lines continue the item above them.
+func renderList(b *strings.Builder, lines []string, start int, marker *regexp.Regexp, tag string) int {
+	var items []string
+	i := start
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if m := marker.FindStringSubmatch(line); m != nil {
+			items = append(items, m[1])
+			continue
+		}
+		if strings.TrimSpace(line) != "" && (strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t")) {
+			items[len(items)-1] += "\n" + strings.TrimSpace(line)
+			continue
+		}
+		break
+	}
+	b.WriteString("<" + tag + ">\n")
+	for _, item := range items {
+		b.WriteString("<li>")
+		b.WriteString(renderInline(item, true, 0))
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i - 1
+}
+
+// renderInline converts the spans inside a block. Link text may not contain
+// further links, so links is false while rendering it. Where each emphasis
+// span could close is found up front, so that an opener without a closer
+// doesn't scan the rest of the text again.
+func renderInline(s string, links bool, depth int) string {
+	var b strings.Builder
+	closers := indexClosers(s)
+	nested := depth < maxInlineDepth
+	// linkAt is where the next "](" is, or len(s) when there is none.
+	linkAt := -1
+	for i := 0; i < len(s); {
+		c := s[i]
+		rest := s[i:]
+		switch {
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+		case c == '\n':
+			b.WriteString("<br>\n")
+			i++
+			continue
+		case c == '`':
+			ticks := len(rest) - len(strings.TrimLeft(rest, "`"))
+			if end := strings.Index(rest[ticks:], rest[:ticks]); end >= 0 {
+				b.WriteString("<code>")
+				b.WriteString(html.EscapeString(strings.TrimSpace(rest[ticks : ticks+end])))
+				b.WriteString("</code>")
+				i += 2*ticks + end
+				continue
+			}
+			b.WriteString(rest[:ticks])
+			i += ticks
+			continue
+		case c == '[' && links && nested:
+			if linkAt < i {
+				if linkAt = strings.Index(rest, "]("); linkAt < 0 {
+					linkAt = len(s)
+				} else {
+					linkAt += i
+				}
+			}
+			if linkAt == len(s) {
+				break
+			}
+			if text, href, n, ok := parseLink(rest, linkAt-i); ok {
+				if safeURL(href) {
+					b.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow noopener noreferrer" target="_blank">`)
+					b.WriteString(renderInline(text, false, depth+1))
+					b.WriteString("</a>")
+				} else {
+					b.WriteString(renderInline(text, false, depth+1))
+				}
+				i += n
+				continue
+			}
+		case links && (strings.HasPrefix(rest, "http://") || strings.HasPrefix(rest, "https://")) && !wordBefore(s, i):
+			href := bareURL(rest)
+			if safeURL(href) {
+				b.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow noopener noreferrer" target="_blank">`)
+				b.WriteString(html.EscapeString(href))
+				b.WriteString("</a>")
+				i += len(href)
+				continue
+			}
+		case nested && (strings.HasPrefix(rest, "**") || strings.HasPrefix(rest, "__")):
+			if inner, n, ok := delimited(s, i, rest[:2], closers[rest[:2]]); ok {
+				b.WriteString("<strong>" + renderInline(inner, links, depth+1) + "</strong>")
+				i += n
+				continue
+			}
+		case nested && strings.HasPrefix(rest, "~~"):
+			if inner, n, ok := delimited(s, i, "~~", closers["~~"]); ok {
+				b.WriteString("<del>" + renderInline(inner, links, depth+1) + "</del>")
+				i += n
+				continue
+			}
+		case nested && (c == '*' || c == '_'):
+			if inner, n, ok := delimited(s, i, rest[:1], closers[rest[:1]]); ok {
+				b.WriteString("<em>" + renderInline(inner, links, depth+1) + "</em>")
+				i += n
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(rest)
+		b.WriteString(html.EscapeString(rest[:size]))
+		i += size
+	}
+	return b.String()
+}
+
+// indexClosers returns, for each delimiter, the positions in s where it can
+// close a span, in order. A closer must not follow a space, a single
+// delimiter must not be part of a double one, and underscores only close at
+// word boundaries, so that snake_case names are left alone.
+func indexClosers(s string) map[string][]int {
+	closers := map[string][]int{}
+	for p := 1; p < len(s); p++ {
+		if s[p-1] == ' ' {
+			continue
+		}
+		for _, delim := range delimiters {
+			after := p + len(delim)
+			if !strings.HasPrefix(s[p:], delim) {
+				continue
+			}
+			if len(delim) == 1 && (s[p-1] == delim[0] || after < len(s) && s[after] == delim[0]) {
+				continue
+			}
+			if delim[0] == '_' && after < len(s) && isWord(s[after:]) {
+				continue
+			}
+			closers[delim] = append(closers[delim], p)
+		}
+	}
+	return closers
+}
+
+// delimited finds the span opened by delim at s[i], returning what is between
+// the delimiters and the length of the whole span. closers are the positions
+// where delim can close a span, as found by indexClosers.
+func delimited(s string, i int, delim string, closers []int) (string, int, bool) {
+	if delim[0] == '_' && wordBefore(s, i) {
+		return "", 0, false
+	}
+	start := i + len(delim)
+	if start >= len(s) || s[start] == ' ' || s[start] == '\n' {
+		return "", 0, false
+	}
+	// The span must not be empty.
+	k := sort.SearchInts(closers, start+1)
+	if k == len(closers) {
+		return "", 0, false
+	}
+	end := closers[k]
+	return s[start:end], end + len(delim) - i, true
+}
+
+// parseLink reads a [text](url) link at the start of s, where close is the
+// position of the first "](" in s.
+func parseLink(s string, close int) (text, href string, n int, ok bool) {
+	if strings.Contains(s[:close], "\n") {
+		return "", "", 0, false
+	}
+	dest := s[close+2:]
+	if len(dest) > maxLinkLength {
+		dest = dest[:maxLinkLength]
+	}
+	// Parentheses may appear in the URL as long as they are balanced.
+	end, open := -1, 0
+	for j, c := range dest {
+		if c == '(' {
+			open++
+		} else if c == ')' && open > 0 {
+			open--
+		} else if c == ')' {
+			end = j
+			break
+		}
+	}
+	if end < 0 {
+		return "", "", 0, false
+	}
+	href = strings.TrimSpace(s[close+2 : close+2+end])
+	if href == "" || strings.ContainsAny(href, " \n") {
+		return "", "", 0, false
+	}
+	return s[1:close], href, close + 3 + end, true
+}
+
+// bareURL returns the URL at the start of s, without the punctuation that
+// usually follows a URL in a sentence.
+func bareURL(s string) string {
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '<' || r == '>' || r == '"'
+	})
+	if end < 0 {
+		end = len(s)
+	}
+	return strings.TrimRight(s[:end], ".,;:!?)'*_~")
+}
+
+// safeURL reports whether href can be used as a link.
+func safeURL(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	}
+	return false
+}
+
+func wordBefore(s string, i int) bool {
+	if i == 0 {
+		return false
+	}
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isWord(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isPunct(c byte) bool {
+	return c < utf8.RuneSelf && unicode.IsPunct(rune(c)) || strings.IndexByte("`*_~[]()#+-.!>\\", c) >= 0
+}
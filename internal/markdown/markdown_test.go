@@ -0,0 +1,57 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const linkAttrs = ` rel="nofollow noopener noreferrer" target="_blank"`
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"emphasis", "**bold**, *em*, ~~gone~~ and snake_case_name", "<p><strong>bold</strong>, <em>em</em>, <del>gone</del> and snake_case_name</p>\n"},
+		{"unclosed emphasis", "**a and *b", "<p>**a and *b</p>\n"},
+		{"blocks", "# Title\n\n- one\n- two\n\n> quoted\n\n***", "<h1>Title</h1>\n<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n<blockquote>\n<p>quoted</p>\n</blockquote>\n<hr>\n"},
+		{"line breaks", "one\ntwo", "<p>one<br>\ntwo</p>\n"},
+		{"link", "[site](https://example.com)", `<p><a href="https://example.com"` + linkAttrs + `>site</a></p>` + "\n"},
+		{"mailto link", "[mail](mailto:someone@example.com)", `<p><a href="mailto:someone@example.com"` + linkAttrs + `>mail</a></p>` + "\n"},
+		{"bare URL", "see https://example.com.", `<p>see <a href="https://example.com"` + linkAttrs + `>https://example.com</a>.</p>` + "\n"},
+		{"javascript link", "[x](javascript:alert(1))", "<p>x</p>\n"},
+		{"javascript link in mixed case", "[x](JaVaScRiPt:alert(1))", "<p>x</p>\n"},
+		{"data link", "[x](data:text/html;base64,PHNjcmlwdD4=)", "<p>x</p>\n"},
+		{"protocol-relative link", "[x](//evil.example/path)", "<p>x</p>\n"},
+		{"double quote in link", `[x](https://example.com/"onmouseover="alert(1))`, `<p><a href="https://example.com/&#34;onmouseover=&#34;alert(1)"` + linkAttrs + `>x</a></p>` + "\n"},
+		{"single quote in link", `[x](https://example.com/'><script>)`, `<p><a href="https://example.com/&#39;&gt;&lt;script&gt;"` + linkAttrs + `>x</a></p>` + "\n"},
+		{"double quote in bare URL", `https://example.com/"onclick="alert(1)`, `<p><a href="https://example.com/"` + linkAttrs + `>https://example.com/</a>&#34;onclick=&#34;alert(1)</p>` + "\n"},
+		{"raw HTML", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"raw HTML attribute", "<img src=x onerror=alert(1)>", "<p>&lt;img src=x onerror=alert(1)&gt;</p>\n"},
+		{"HTML in link text", "[<b>x</b>](https://example.com)", `<p><a href="https://example.com"` + linkAttrs + `>&lt;b&gt;x&lt;/b&gt;</a></p>` + "\n"},
+		{"HTML in code", "`<b>code</b>`", "<p><code>&lt;b&gt;code&lt;/b&gt;</code></p>\n"},
+		{"HTML in fence", "```\n<script>\n```", "<pre><code>&lt;script&gt;</code></pre>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(Render(tt.src)); got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRenderIsLinear renders inputs that made the renderer scan the rest of
+// the line for every opener. At this size that took seconds.
+func TestRenderIsLinear(t *testing.T) {
+	for _, unit := range []string{"**a ", "*a ", "_a ", "~~a ", "[", "[a](", "` ", "*a *a *a a* a* "} {
+		src := strings.Repeat(unit, 20000)
+		start := time.Now()
+		Render(src)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Render(%q × 20000) took %v", unit, elapsed)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"gorm.io/gorm"
+	"time"
 )
 
 type User struct {
@@ -11,6 +12,11 @@ type User struct {
 	Password       string    `gorm:"not null"`
 	Folders        []*Folder `gorm:"many2many:user_folders;"`
 	ProfilePicture string
+	// DeletionRequestedAt starts the grace period after which the account
+	// and everything it owns is purged.
+	DeletionRequestedAt *time.Time
+	// DefaultFolderID is where quick saves go when no folder is picked.
+	DefaultFolderID *uint
 }
 
 type Item struct {
@@ -19,6 +25,14 @@ type Item struct {
 	URL      string `gorm:"not null"`
 	FolderID uint
 	OwnerID  uint
+	// LinkBroken is set by the link checker when URL stopped responding.
+	LinkBroken    bool
+	LinkCheckedAt *time.Time
+	// GUID is the id of the feed entry the item was added from, if any.
+	GUID string `gorm:"index" json:",omitempty"`
+	// Notes is Markdown written about the item, rendered with the markdown
+	// package.
+	Notes string `gorm:"type:text"`
 }
 
 type Folder struct {
@@ -30,4 +44,205 @@ type Folder struct {
 	Items         []*Item `gorm:"foreignKey:FolderID"`
 	Private       bool
 	CoverURL      string
+	Tags          []*Tag `gorm:"many2many:folder_tags;"`
+	LikeCount     int
+	SaveCount     int
+	// ClonedFromID and ClonedFromOwner credit the folder this one was cloned
+	// from, if any.
+	ClonedFromID    *uint
+	ClonedFromOwner string
+	// ParentID is the folder this one is nested in, or nil at the top level.
+	// A folder inside a private folder is always private.
+	ParentID *uint `gorm:"index"`
+	// Inbox marks the folder every account gets for links saved without
+	// picking a folder. It can't be deleted.
+	Inbox bool
+}
+
+// FolderLike records that a user liked a public folder.
+type FolderLike struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	FolderID  uint `gorm:"uniqueIndex:idx_folder_like;index;not null"`
+	UserID    uint `gorm:"uniqueIndex:idx_folder_like;not null"`
+}
+
+// SavedFolder puts someone else's public folder in a user's library. It
+// references the folder rather than copying it, so it stays up to date.
+type SavedFolder struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	FolderID  uint `gorm:"uniqueIndex:idx_saved_folder;index;not null"`
+	UserID    uint `gorm:"uniqueIndex:idx_saved_folder;not null"`
+}
+
+// Comment is a message on a folder, or on one of its items when ItemID is
+// set. Replies point to the comment they answer with ParentID.
+type Comment struct {
+	ID             uint `gorm:"primarykey"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	FolderID       uint  `gorm:"index;not null"`
+	ItemID         *uint `gorm:"index"`
+	ParentID       *uint `gorm:"index"`
+	AuthorID       uint  `gorm:"index"`
+	AuthorUsername string
+	Body           string
+	EditedAt       *time.Time
+	// Removed comments keep their place in the thread so replies to them
+	// still make sense, but their body is cleared.
+	Removed bool
+}
+
+// Notification tells a user about something that happened to their folders,
+// items or comments. It is unread until ReadAt is set.
+type Notification struct {
+	ID            uint `gorm:"primarykey"`
+	CreatedAt     time.Time
+	UserID        uint `gorm:"index;not null"`
+	Kind          string
+	ActorUsername string
+	FolderID      *uint
+	ItemID        *uint
+	CommentID     *uint
+	Subject       string
+	ReadAt        *time.Time
+}
+
+// NotificationPreference records whether a user wants notifications of a
+// kind. Kinds without a preference are enabled.
+type NotificationPreference struct {
+	ID      uint   `gorm:"primarykey"`
+	UserID  uint   `gorm:"uniqueIndex:idx_notification_preference;not null"`
+	Kind    string `gorm:"uniqueIndex:idx_notification_preference;not null"`
+	Enabled bool
+}
+
+// Webhook posts a folder's events to URL as JSON signed with Secret, so the
+// receiver can check they came from Twilu.
+type Webhook struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	FolderID  uint `gorm:"index;not null"`
+	URL       string
+	Secret    string `json:"-"`
+}
+
+// WebhookDelivery is one event queued for a webhook. It is retried until it
+// is delivered or runs out of attempts; NextAttemptAt is nil once it is done.
+type WebhookDelivery struct {
+	ID            uint `gorm:"primarykey"`
+	CreatedAt     time.Time
+	WebhookID     uint `gorm:"index;not null"`
+	Event         string
+	Payload       string
+	Status        string
+	Attempts      int
+	NextAttemptAt *time.Time `gorm:"index"`
+	LastStatus    int
+	LastError     string
+}
+
+// FeedSubscription adds the entries of an RSS or Atom feed to a folder as they
+// are published. ETag and LastModified are echoed back to the feed's server so
+// that unchanged feeds aren't downloaded again.
+type FeedSubscription struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	FolderID     uint `gorm:"index;not null"`
+	URL          string
+	Title        string
+	ETag         string `json:"-"`
+	LastModified string `json:"-"`
+	LastPolledAt *time.Time
+	LastError    string
+}
+
+// SmartFolder is a saved query over the items of the folders its owner can
+// add to. Its contents are worked out from the rules on every view; blank
+// rules match everything.
+type SmartFolder struct {
+	ID              uint `gorm:"primarykey"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	OwnerID         uint `gorm:"index;not null"`
+	Name            string
+	Tag             string
+	Domain          string
+	AddedWithinDays int
+	BrokenOnly      bool
+}
+
+// ItemState is how far a user has got with reading an item. Items without
+// one are unread. The timestamps record when the item last entered each
+// state.
+type ItemState struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uint   `gorm:"uniqueIndex:idx_item_state;not null"`
+	ItemID     uint   `gorm:"uniqueIndex:idx_item_state;index;not null"`
+	State      string `gorm:"not null"`
+	StartedAt  *time.Time
+	ReadAt     *time.Time
+	ArchivedAt *time.Time
+}
+
+// Tag is a lowercase label that folders can be filtered by in the feed.
+type Tag struct {
+	ID   uint
+	Name string `gorm:"uniqueIndex"`
+}
+
+type APIToken struct {
+	gorm.Model
+	UserID     uint   `gorm:"index;not null"`
+	Name       string `gorm:"not null"`
+	Prefix     string `gorm:"not null"`
+	TokenHash  string `gorm:"uniqueIndex;not null"`
+	Scopes     string `gorm:"not null"`
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+}
+
+type Identity struct {
+	gorm.Model
+	UserID  uint   `gorm:"index;not null"`
+	Issuer  string `gorm:"uniqueIndex:idx_identity_issuer_subject;not null"`
+	Subject string `gorm:"uniqueIndex:idx_identity_issuer_subject;not null"`
+}
+
+type AuditEvent struct {
+	ID            uint      `gorm:"primarykey"`
+	CreatedAt     time.Time `gorm:"index"`
+	ActorID       uint      `gorm:"index"`
+	ActorUsername string
+	Action        string `gorm:"not null"`
+	// SubjectUserID is the account acted upon, when it isn't the actor's own.
+	SubjectUserID *uint `gorm:"index"`
+	FolderID      *uint `gorm:"index"`
+	ItemID        *uint
+	IP            string
+	Detail        string
+}
+
+type FolderActivity struct {
+	ID            uint      `gorm:"primarykey"`
+	CreatedAt     time.Time `gorm:"index"`
+	FolderID      uint      `gorm:"index;not null"`
+	ActorID       uint
+	ActorUsername string
+	Kind          string `gorm:"not null"`
+	ItemID        *uint
+	// Subject is what the activity is about, such as the item name, and
+	// Detail holds any extra context such as the previous name.
+	Subject string
+	Detail  string
+}
+
+type Follow struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	FollowerID uint `gorm:"uniqueIndex:idx_follow_pair;not null"`
+	FolloweeID uint `gorm:"uniqueIndex:idx_follow_pair;index;not null"`
 }
@@ -0,0 +1,270 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// clockSkew is the leeway allowed when checking exp, iat and nbf.
+const clockSkew = 2 * time.Minute
+
+// keyRefreshInterval is how long after fetching the JWKS an unknown key id is
+// rejected outright, so that tokens with made-up key ids can't make us fetch
+// it on every sign in.
+const keyRefreshInterval = time.Minute
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type idTokenPayload struct {
+	Issuer            string          `json:"iss"`
+	Subject           string          `json:"sub"`
+	Audience          json.RawMessage `json:"aud"`
+	AuthorizedParty   string          `json:"azp"`
+	Expiry            float64         `json:"exp"`
+	IssuedAt          float64         `json:"iat"`
+	NotBefore         float64         `json:"nbf"`
+	Nonce             string          `json:"nonce"`
+	Email             string          `json:"email"`
+	EmailVerified     any             `json:"email_verified"`
+	PreferredUsername string          `json:"preferred_username"`
+	Name              string          `json:"name"`
+	Picture           string          `json:"picture"`
+}
+
+// Verify checks the ID token signature against the issuer's JWKS and
+// validates the issuer, audience, lifetime and nonce claims.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return Claims{}, fmt.Errorf("malformed id token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, fmt.Errorf("malformed id token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, fmt.Errorf("malformed id token signature: %w", err)
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return Claims{}, err
+	}
+
+	var payload idTokenPayload
+	if err := decodeSegment(parts[1], &payload); err != nil {
+		return Claims{}, fmt.Errorf("malformed id token payload: %w", err)
+	}
+	if strings.TrimSuffix(payload.Issuer, "/") != strings.TrimSuffix(p.cfg.Issuer, "/") {
+		return Claims{}, fmt.Errorf("id token issued by %q, expected %q", payload.Issuer, p.cfg.Issuer)
+	}
+	audiences, err := parseAudience(payload.Audience)
+	if err != nil {
+		return Claims{}, err
+	}
+	if !slices.Contains(audiences, p.cfg.ClientID) {
+		return Claims{}, fmt.Errorf("id token audience does not include this client")
+	}
+	if len(audiences) > 1 && payload.AuthorizedParty != p.cfg.ClientID {
+		return Claims{}, fmt.Errorf("id token authorized party does not match this client")
+	}
+	now := time.Now()
+	if payload.Expiry == 0 || now.Add(-clockSkew).After(unixTime(payload.Expiry)) {
+		return Claims{}, fmt.Errorf("id token expired")
+	}
+	if payload.IssuedAt != 0 && now.Add(clockSkew).Before(unixTime(payload.IssuedAt)) {
+		return Claims{}, fmt.Errorf("id token issued in the future")
+	}
+	if payload.NotBefore != 0 && now.Add(clockSkew).Before(unixTime(payload.NotBefore)) {
+		return Claims{}, fmt.Errorf("id token not valid yet")
+	}
+	if payload.Nonce != nonce {
+		return Claims{}, fmt.Errorf("id token nonce mismatch")
+	}
+	if payload.Subject == "" {
+		return Claims{}, fmt.Errorf("id token has no subject")
+	}
+
+	return Claims{
+		Issuer:            payload.Issuer,
+		Subject:           payload.Subject,
+		Nonce:             payload.Nonce,
+		Email:             payload.Email,
+		EmailVerified:     payload.EmailVerified == true || payload.EmailVerified == "true",
+		PreferredUsername: payload.PreferredUsername,
+		Name:              payload.Name,
+		Picture:           payload.Picture,
+	}, nil
+}
+
+// key returns the signing key with the given id, refreshing the JWKS once if
+// the key is unknown so issuer key rotation is picked up. The JWKS is fetched
+// at most once per keyRefreshInterval.
+func (p *Provider) key(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	key, ok := p.lookupKey(kid)
+	recent := time.Since(p.keysFetchedAt) < keyRefreshInterval
+	if !ok && !recent {
+		p.keysFetchedAt = time.Now()
+	}
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if recent {
+		return nil, fmt.Errorf("no signing key found for kid %q", kid)
+	}
+	if err := p.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("no signing key found for kid %q", kid)
+}
+
+func (p *Provider) lookupKey(kid string) (any, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) refreshKeys(ctx context.Context) error {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+		return fmt.Errorf("unable to fetch jwks: %w", err)
+	}
+	keys := make(map[string]any)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+	return nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func verifySignature(alg string, key any, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type does not match alg %s", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("invalid id token signature")
+		}
+		return nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return fmt.Errorf("key type does not match alg %s", alg)
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return fmt.Errorf("invalid id token signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported id token alg %q", alg)
+}
+
+func parseAudience(raw json.RawMessage) ([]string, error) {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return []string{single}, nil
+	}
+	var many []string
+	if err := json.Unmarshal(raw, &many); err != nil {
+		return nil, fmt.Errorf("malformed id token audience")
+	}
+	return many, nil
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func unixTime(v float64) time.Time {
+	return time.Unix(int64(v), 0)
+}
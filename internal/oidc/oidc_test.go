@@ -0,0 +1,200 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mockIssuer is an OpenID provider serving discovery, a JWKS with one RSA
+// key, and a token endpoint that hands out whatever idToken is set to.
+type mockIssuer struct {
+	*httptest.Server
+	key     *rsa.PrivateKey
+	kid     string
+	idToken string
+	// jwksFetches counts the requests for the JWKS.
+	jwksFetches atomic.Int32
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key, kid: "test"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.jwksFetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "code" || r.PostFormValue("code_verifier") != "verifier" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.idToken})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// sign returns an RS256 ID token with the claims, signed with key.
+func (m *mockIssuer) sign(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": m.kid, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (m *mockIssuer) claims() map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss":            m.URL,
+		"sub":            "user-1",
+		"aud":            "twilu",
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          "nonce",
+		"email":          "Someone@Example.com",
+		"email_verified": true,
+	}
+}
+
+func TestExchange(t *testing.T) {
+	issuer := newMockIssuer(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		key     *rsa.PrivateKey
+		change  func(claims map[string]any)
+		wantErr string
+	}{
+		{name: "valid"},
+		{name: "bad signature", key: otherKey, wantErr: "invalid id token signature"},
+		{name: "wrong audience", change: func(c map[string]any) { c["aud"] = "someone-else" }, wantErr: "audience"},
+		{name: "wrong authorized party", change: func(c map[string]any) { c["aud"] = []string{"twilu", "other"}; c["azp"] = "other" }, wantErr: "authorized party"},
+		{name: "wrong issuer", change: func(c map[string]any) { c["iss"] = "https://evil.example" }, wantErr: "issued by"},
+		{name: "wrong nonce", change: func(c map[string]any) { c["nonce"] = "replayed" }, wantErr: "nonce"},
+		{name: "expired", change: func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, wantErr: "expired"},
+		{name: "not valid yet", change: func(c map[string]any) { c["nbf"] = time.Now().Add(time.Hour).Unix() }, wantErr: "not valid yet"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := issuer.key
+			if tt.key != nil {
+				key = tt.key
+			}
+			claims := issuer.claims()
+			if tt.change != nil {
+				tt.change(claims)
+			}
+			issuer.idToken = issuer.sign(t, key, claims)
+			provider := NewProvider(Config{Issuer: issuer.URL, ClientID: "twilu", ClientSecret: "secret", RedirectURL: "http://localhost/callback"})
+
+			got, err := provider.Exchange(context.Background(), "code", "verifier", "nonce")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Exchange() error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+			if got.Subject != "user-1" || got.Email != "Someone@Example.com" || !got.EmailVerified {
+				t.Errorf("Exchange() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.idToken = issuer.sign(t, issuer.key, issuer.claims())
+	provider := NewProvider(Config{Issuer: issuer.URL, ClientID: "twilu"})
+	if _, err := provider.Exchange(context.Background(), "code", "wrong", "nonce"); err == nil {
+		t.Fatal("Exchange() accepted a code with the wrong PKCE verifier")
+	}
+}
+
+func TestUnknownKeyIDRefetchesKeysOnce(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := NewProvider(Config{Issuer: issuer.URL, ClientID: "twilu"})
+	issuer.idToken = issuer.sign(t, issuer.key, issuer.claims())
+	if _, err := provider.Exchange(context.Background(), "code", "verifier", "nonce"); err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	issuer.kid = "made-up"
+	issuer.idToken = issuer.sign(t, issuer.key, issuer.claims())
+	for i := 0; i < 3; i++ {
+		if _, err := provider.Exchange(context.Background(), "code", "verifier", "nonce"); err == nil || !strings.Contains(err.Error(), "no signing key") {
+			t.Fatalf("Exchange() error = %v, want an unknown key error", err)
+		}
+	}
+	if got := issuer.jwksFetches.Load(); got != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", got)
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := NewProvider(Config{Issuer: issuer.URL, ClientID: "twilu", RedirectURL: "http://localhost/callback"})
+	got, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := sha256.Sum256([]byte("verifier"))
+	for _, want := range []string{
+		issuer.URL + "/authorize?",
+		"code_challenge=" + base64.RawURLEncoding.EncodeToString(challenge[:]),
+		"code_challenge_method=S256",
+		"state=state",
+		"nonce=nonce",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("AuthCodeURL() = %s, want it to contain %s", got, want)
+		}
+	}
+}
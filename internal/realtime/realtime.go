@@ -0,0 +1,75 @@
+// Package realtime delivers folder events to the pages that have the folder
+// open.
+package realtime
+
+import "sync"
+
+// Event is a change to a folder's items. Kind is one of the folder activity
+// kinds.
+type Event struct {
+	FolderID      uint
+	Kind          string
+	ItemID        uint
+	Name          string
+	ActorUsername string
+}
+
+// FanOut delivers published events to the subscribers of their folder. Broker
+// does so within one process; running several servers needs a FanOut backed
+// by something they share.
+type FanOut interface {
+	Publish(event Event)
+	// Subscribe returns the folder's events until cancel is called.
+	Subscribe(folderID uint) (events <-chan Event, cancel func())
+}
+
+// subscriberBuffer is how many events a slow subscriber may fall behind by
+// before further events are dropped for it.
+const subscriberBuffer = 16
+
+// Broker is an in-process FanOut.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[uint]map[chan Event]struct{}
+}
+
+// NewBroker creates a new instance of Broker.
+func NewBroker() *Broker {
+	return &Broker{subscribers: make(map[uint]map[chan Event]struct{})}
+}
+
+// Publish sends the event to the folder's subscribers without waiting on
+// them.
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers[event.FolderID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+func (b *Broker) Subscribe(folderID uint) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	if b.subscribers[folderID] == nil {
+		b.subscribers[folderID] = make(map[chan Event]struct{})
+	}
+	b.subscribers[folderID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers[folderID], ch)
+			if len(b.subscribers[folderID]) == 0 {
+				delete(b.subscribers, folderID)
+			}
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
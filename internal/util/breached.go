@@ -0,0 +1,61 @@
+package util
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// BreachedList is a set of SHA-1 password hashes known to have leaked.
+type BreachedList struct {
+	hashes map[[sha1.Size]byte]struct{}
+}
+
+// LoadBreachedList reads a file of hex SHA-1 hashes, one per line. Lines in
+// the Have I Been Pwned "HASH:COUNT" format are accepted as well.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	list := &BreachedList{hashes: make(map[[sha1.Size]byte]struct{})}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text, _, _ = strings.Cut(text, ":")
+		var sum [sha1.Size]byte
+		// hex.Decode writes past sum on longer lines, so check the length first.
+		if len(text) != hex.EncodedLen(sha1.Size) {
+			return nil, fmt.Errorf("%s:%d: not a SHA-1 hash", path, line)
+		}
+		if _, err := hex.Decode(sum[:], []byte(text)); err != nil {
+			return nil, fmt.Errorf("%s:%d: not a SHA-1 hash", path, line)
+		}
+		list.hashes[sum] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Contains reports whether password is in the list.
+func (b *BreachedList) Contains(password string) bool {
+	_, ok := b.hashes[sha1.Sum([]byte(password))]
+	return ok
+}
+
+// Len returns the number of hashes in the list.
+func (b *BreachedList) Len() int {
+	return len(b.hashes)
+}
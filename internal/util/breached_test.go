@@ -0,0 +1,51 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeList(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadBreachedList(t *testing.T) {
+	// SHA-1 of "password".
+	const hash = "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8"
+	list, err := LoadBreachedList(writeList(t, "# leaked\n\n"+hash+":3861493\n"+strings.ToLower(hash)+"\n"))
+	if err != nil {
+		t.Fatalf("LoadBreachedList() error = %v", err)
+	}
+	if list.Len() != 1 || !list.Contains("password") || list.Contains("correct horse") {
+		t.Fatalf("LoadBreachedList() loaded %d hashes", list.Len())
+	}
+}
+
+func TestLoadBreachedListRejectsBadLines(t *testing.T) {
+	const hash = "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8"
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"too long", hash + "00"},
+		{"much too long", strings.Repeat(hash, 4)},
+		{"too short", hash[:38]},
+		{"odd length", hash[:39]},
+		{"not hex", strings.Repeat("zz", 20)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadBreachedList(writeList(t, hash+"\n"+tt.line+"\n"))
+			if err == nil || !strings.HasSuffix(err.Error(), ":2: not a SHA-1 hash") {
+				t.Fatalf("LoadBreachedList() error = %v, want line 2 rejected", err)
+			}
+		})
+	}
+}
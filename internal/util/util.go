@@ -1,34 +1,109 @@
 package util
 
-import "unicode"
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
 
-func PasswordIsValid(password string) bool {
-	if len(password) < 6 {
-		return false
+// Names of the password policy rules, reported in PasswordError.Rule.
+const (
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleUpper     = "uppercase"
+	RuleLower     = "lowercase"
+	RuleDigit     = "digit"
+	RuleSpecial   = "special"
+	RuleBreached  = "breached"
+)
+
+// maxPasswordBytes is the longest input bcrypt will hash.
+const maxPasswordBytes = 72
+
+// PasswordPolicy describes what a new password must look like.
+type PasswordPolicy struct {
+	MinLength      int
+	RequireUpper   bool
+	RequireLower   bool
+	RequireDigit   bool
+	RequireSpecial bool
+	// PassphraseLength waives the character class rules for passwords at
+	// least this many characters long. Zero disables passphrase mode.
+	PassphraseLength int
+	// Breached, when set, rejects passwords found in a known breach.
+	Breached *BreachedList
+}
+
+// DefaultPasswordPolicy returns the policy used when nothing is configured.
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:        6,
+		RequireUpper:     true,
+		RequireLower:     true,
+		RequireDigit:     true,
+		RequireSpecial:   true,
+		PassphraseLength: 20,
 	}
-	var (
-		hasUpper, hasLower, hasDigit, hasSpecial bool
-	)
-	for _, char := range password {
-		if unicode.IsUpper(char) {
-			hasUpper = true
-		} else if unicode.IsLower(char) {
-			hasLower = true
-		} else if unicode.IsDigit(char) {
-			hasDigit = true
-		} else if isSpecial(char) {
-			hasSpecial = true
+}
+
+// PasswordError reports the policy rule a password failed.
+type PasswordError struct {
+	Rule    string
+	Message string
+}
+
+func (e *PasswordError) Error() string {
+	return e.Message
+}
+
+// Validate returns a *PasswordError for the first rule password breaks.
+func (p PasswordPolicy) Validate(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return &PasswordError{RuleMinLength, fmt.Sprintf("Password must be at least %d characters long", p.MinLength)}
+	}
+	if len(password) > maxPasswordBytes {
+		return &PasswordError{RuleMaxLength, fmt.Sprintf("Password must be at most %d bytes long", maxPasswordBytes)}
+	}
+
+	if p.PassphraseLength == 0 || length < p.PassphraseLength {
+		var (
+			hasUpper, hasLower, hasDigit, hasSpecial bool
+		)
+		for _, char := range password {
+			if unicode.IsUpper(char) {
+				hasUpper = true
+			} else if unicode.IsLower(char) {
+				hasLower = true
+			} else if unicode.IsDigit(char) {
+				hasDigit = true
+			} else if isSpecial(char) {
+				hasSpecial = true
+			}
+		}
+		passphrase := ""
+		if p.PassphraseLength > 0 {
+			passphrase = fmt.Sprintf(", or be at least %d characters long", p.PassphraseLength)
+		}
+		switch {
+		case p.RequireUpper && !hasUpper:
+			return &PasswordError{RuleUpper, "Password must contain an uppercase letter" + passphrase}
+		case p.RequireLower && !hasLower:
+			return &PasswordError{RuleLower, "Password must contain a lowercase letter" + passphrase}
+		case p.RequireDigit && !hasDigit:
+			return &PasswordError{RuleDigit, "Password must contain a digit" + passphrase}
+		case p.RequireSpecial && !hasSpecial:
+			return &PasswordError{RuleSpecial, "Password must contain a special character" + passphrase}
 		}
 	}
-	return hasUpper && hasLower && hasDigit && hasSpecial
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		return &PasswordError{RuleBreached, "Password has appeared in a data breach, please choose another"}
+	}
+	return nil
 }
 
+// isSpecial reports whether char is punctuation, a symbol or a space.
 func isSpecial(char rune) bool {
-	specialCharacters := "!@#$%^&*()_+{}[]|:;<>,.?/~"
-	for _, special := range specialCharacters {
-		if char == special {
-			return true
-		}
-	}
-	return false
+	return unicode.IsPunct(char) || unicode.IsSymbol(char) || unicode.IsSpace(char)
 }